@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"crypto/rsa"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
@@ -29,6 +31,11 @@ type menuSelections struct {
 var cpPrivateKey *rsa.PrivateKey
 var adminAuthToken string
 
+// Base URL and http client used for every cp-api request. Tests point these
+// at an in-process fake server.
+var apiBaseUrl = "http://localhost:8000"
+var apiClient = instrumentClient(&http.Client{})
+
 // Hetzner API client.
 var hcloudClient *hcloud.Client
 
@@ -86,6 +93,10 @@ var menu = [...]menuItems{
 				desc: "Create Exim",
 				cmd:  wrappedCreateExim,
 			},
+			{
+				desc: "Create Edge-Case Exims",
+				cmd:  createEdgeCaseExims,
+			},
 			{
 				desc: "Get Exim Details",
 				cmd:  wrappedGetEximDetails,
@@ -94,10 +105,46 @@ var menu = [...]menuItems{
 				desc: "Get (All) Exims",
 				cmd:  getExims,
 			},
+			{
+				desc: "Export Exims",
+				cmd:  runExportExims,
+			},
+			{
+				desc: "Import Exims",
+				cmd:  runImportExims,
+			},
 			{
 				desc: "Logout",
 				cmd:  wrappedLogout,
 			},
+			{
+				desc: "Manage Test Users",
+				cmd:  manageSessionUsers,
+			},
+			{
+				desc: "API Explorer",
+				cmd:  apiExplorer,
+			},
+			{
+				desc: "Check API Contracts",
+				cmd:  runContractCheck,
+			},
+			{
+				desc: "Generate OpenAPI Spec",
+				cmd:  runGenerateOpenAPI,
+			},
+			{
+				desc: "Validate Against OpenAPI Spec",
+				cmd:  runValidateOpenAPI,
+			},
+			{
+				desc: "Browse Recorded Session",
+				cmd:  browseRecording,
+			},
+			{
+				desc: "Replay Recorded Request",
+				cmd:  replayRecordedRequest,
+			},
 		},
 	},
 	{
@@ -105,23 +152,73 @@ var menu = [...]menuItems{
 		children: []command{
 			{
 				desc: "Shutdown Server",
-				cmd:  shutdown,
+				cmd:  wrappedShutdown,
+			},
+			{
+				desc: "Moderate Exims",
+				cmd:  moderateEximQueue,
+			},
+			{
+				desc: "Manage Users",
+				cmd:  userAdminPanel,
+			},
+			{
+				desc: "Browse Buckets",
+				cmd:  browseBuckets,
+			},
+			{
+				desc: "Check Bucket Consistency",
+				cmd:  runConsistencyCheck,
+			},
+			{
+				desc: "Select Acting Admin",
+				cmd:  selectActingAdmin,
+			},
+			{
+				desc: "Create Admin",
+				cmd:  runCreateAdmin,
+			},
+			{
+				desc: "Revoke Admin",
+				cmd:  runRevokeAdmin,
 			},
 			{
-				desc: "Log USER_EMAIL Bucket",
-				cmd:  logUserEmailBucket,
+				desc: "Browse Audit Log",
+				cmd:  browseAuditLog,
 			},
+		},
+	},
+	{
+		parent: "DATA",
+		children: []command{
 			{
-				desc: "Log USER_AUTH Bucket",
-				cmd:  logUserAuthBucket,
+				desc: "Seed Database",
+				cmd:  runSeedDatabase,
 			},
 			{
-				desc: "Log ADMIN_EMAIL Bucket",
-				cmd:  logAdminEmailBucket,
+				desc: "Backup Database",
+				cmd:  runBackupDatabase,
 			},
 			{
-				desc: "Log MOD_EXIM Bucket",
-				cmd:  logModEximBucket,
+				desc: "Restore Database",
+				cmd:  runRestoreDatabase,
+			},
+		},
+	},
+	{
+		parent: "STATUS",
+		children: []command{
+			{
+				desc: "Status Dashboard",
+				cmd:  statusDashboard,
+			},
+			{
+				desc: "cp-api Metrics",
+				cmd:  metricsDashboard,
+			},
+			{
+				desc: "Remote Logs",
+				cmd:  viewRemoteLogs,
 			},
 		},
 	},
@@ -132,6 +229,10 @@ var menu = [...]menuItems{
 				desc: "Run E2E Locally",
 				cmd:  runEndToEndLocal,
 			},
+			{
+				desc: "Run Load Test",
+				cmd:  runLoadTest,
+			},
 		},
 	},
 }
@@ -242,14 +343,14 @@ func updateMenuSelections(bs []byte, ms *menuSelections) {
 func loadEnvVariables() {
 	err := godotenv.Load()
 	if err != nil {
-		fmt.Printf("[err][admin] loading .env file: %v [%s]\n", err, cts())
+		logErrorf("loading .env file: %v", err)
 		os.Exit(1)
 	}
 }
 
 func setHetznerCloudClient() {
 	token := os.Getenv("HETZNER_API_TOKEN")
-	hcloudClient = hcloud.NewClient(hcloud.WithToken(token))
+	hcloudClient = hcloud.NewClient(hcloud.WithToken(token), hcloud.WithInstrumentation(adminMetrics))
 }
 
 func runSelectedCommands() {
@@ -272,7 +373,8 @@ func runSelectedCommands() {
 		if bytes.Equal(bs, enterKey) && ms.selectedChild >= 0 {
 			selectedCommand := menu[ms.selectedParent].children[ms.selectedChild]
 			// Run synchronous command and block until completion.
-			selectedCommand.cmd()
+			withCommandLogger(selectedCommand.desc, selectedCommand.cmd)
+			writeMetricsTextfile()
 		} else {
 			// Some other (non-enter) key was pressed.
 			// Clear the space that the current menu is occupying so the next
@@ -288,17 +390,62 @@ func runSelectedCommands() {
 }
 
 func main() {
+	seed := flag.Int64("seed", 0, "seed for generated test data (default: derived from the clock)")
+	adminName := flag.String("admin", "", "name of the admin to act as (default: the last one selected)")
+	profile := flag.String("profile", "local", "environment to operate against: local or production")
+	flag.BoolVar(&dryRun, "dry-run", false, "print mutating Hetzner, SSH and API calls (admin and user) instead of making them")
+	metricsAddr := flag.String("metrics-addr", "", "serve cp-admin's own metrics on this address, e.g. :9102")
+	flag.StringVar(&metricsTextfile, "metrics-textfile", "", "write cp-admin's own metrics to this file after each command")
+	flag.StringVar(&recordPath, "record", "", "append every cp-api request and response to this session file")
+	flag.StringVar(&contractModeOverride, "contracts", "", "handling of cp-api responses that drift from their contracts: strict or lenient (default: per profile)")
+	logFormat := flag.String("log-format", "console", "log output format: console, or json for CI")
+	level := flag.String("log-level", "info", "minimum log level: debug (dumps HTTP traffic, secrets redacted), info, warn or error")
+	flag.Parse()
+
+	err := setLogger(*logFormat, *level)
+	if err != nil {
+		logErrorf("%v", err)
+		os.Exit(1)
+	}
+
 	loadEnvVariables()
 
+	err = setProfile(*profile)
+	if err != nil {
+		logErrorf("%v", err)
+		os.Exit(1)
+	}
+	logger = logger.With("env", activeProfile)
+	if contractModeOverride != "" && contractModeOverride != "strict" && contractModeOverride != "lenient" {
+		logErrorf("invalid -contracts %q (want strict or lenient)", contractModeOverride)
+		os.Exit(1)
+	}
+	logInfof("profile: %s (%s)", activeProfile, apiBaseUrl)
+	if dryRun {
+		logInfof("dry-run mode: mutating calls will be printed, not made")
+	}
+
+	// Seed test data generation, printing the seed so runs can be reproduced.
+	setDataSeed(*seed)
+	logInfof("test data seed: %d (rerun with -seed=%d to reproduce)", dataSeed, dataSeed)
+
 	// Generate private key file if it doesn't already exist.
-	_, err := os.Stat("cp.pem")
+	_, err = os.Stat("cp.pem")
 	if os.IsNotExist(err) {
 		generatePrivateKeyFile()
 	}
 
-	setPrivateKey()
-	setAdminAuthToken()
+	err = setActingAdmin(*adminName)
+	if err != nil {
+		logErrorf("selecting acting admin: %v", err)
+		os.Exit(1)
+	}
+	logInfof("acting as admin %s (%s)", actingAdmin.Name, actingAdmin.AdminId)
 	setHetznerCloudClient()
+	if *metricsAddr != "" {
+		serveAdminMetrics(*metricsAddr)
+	}
 	runSelectedCommands()
-	fmt.Printf("[admin] exiting... [%s]\n", cts())
+	writeMetricsTextfile()
+	logInfof("exiting...")
 }
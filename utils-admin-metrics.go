@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry for cp-admin's own metrics: every cp-api call it makes and, via
+// hcloud-go's instrumentation, every Hetzner API call.
+var adminMetrics = prometheus.NewRegistry()
+
+// File the registry is written to after each command, for node_exporter's
+// textfile collector. Empty disables it.
+var metricsTextfile string
+
+var apiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cp_admin_api_requests_total",
+	Help: "cp-api requests made by cp-admin, by operation, endpoint and status code.",
+}, []string{"operation", "endpoint", "code"})
+
+var apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "cp_admin_api_request_duration_seconds",
+	Help:    "Duration of cp-api requests made by cp-admin, by operation and endpoint.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation", "endpoint"})
+
+func init() {
+	adminMetrics.MustRegister(apiRequestsTotal, apiRequestDuration)
+}
+
+// cp-api routes and the operation names they're reported under. Routes ending
+// in "/" take an id, which is dropped from the endpoint label.
+var apiOperations = []struct {
+	prefix    string
+	operation string
+}{
+	{"/api/user/signup/", "signup"},
+	{"/api/user/login-code/", "loginCode"},
+	{"/api/user/login/", "login"},
+	{"/api/user/logout/", "logout"},
+	{"/api/exim/create/", "createExim"},
+	{"/api/exim/", "getEximDetails"},
+	{"/api/exims", "getExims"},
+	{"/api/admin/bypass-email/", "bypassEmail"},
+	{"/api/admin/shutdown/", "shutdown"},
+	{"/metrics", "metrics"},
+}
+
+// Maps a request path to its operation and endpoint label, collapsing ids so
+// label cardinality stays bounded.
+func apiOperation(path string) (string, string) {
+	for _, op := range apiOperations {
+		if strings.HasPrefix(path, op.prefix) {
+			if strings.HasSuffix(op.prefix, "/") && len(path) > len(op.prefix) {
+				return op.operation, op.prefix + "{id}"
+			}
+			return op.operation, op.prefix
+		}
+	}
+	// Other admin endpoints are reported by their first path segment.
+	if rest, ok := strings.CutPrefix(path, "/api/admin/"); ok {
+		segment, _, _ := strings.Cut(rest, "/")
+		return "admin:" + segment, "/api/admin/" + segment
+	}
+	return "other", "other"
+}
+
+// RoundTripper recording each request's operation, status and duration.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation, endpoint := apiOperation(req.URL.Path)
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	apiRequestDuration.WithLabelValues(operation, endpoint).Observe(time.Since(start).Seconds())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	apiRequestsTotal.WithLabelValues(operation, endpoint, code).Inc()
+	return res, err
+}
+
+// Wraps client's transport so its requests are counted, timed, logged and,
+// with -record, recorded.
+func instrumentClient(client *http.Client) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	instrumented := *client
+	instrumented.Transport = metricsTransport{next: loggingTransport{next: recordingTransport{next: next}}}
+	return &instrumented
+}
+
+// Serves cp-admin's metrics on addr (e.g. ":9102") in the background.
+func serveAdminMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(adminMetrics, promhttp.HandlerOpts{}))
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		logErrorf("serving metrics on %s: %v", addr, err)
+	}()
+	logInfof("serving cp-admin metrics at http://%s/metrics", addr)
+}
+
+// Writes the registry to metricsTextfile, if one is configured.
+func writeMetricsTextfile() {
+	if metricsTextfile == "" {
+		return
+	}
+	if err := prometheus.WriteToTextfile(metricsTextfile, adminMetrics); err != nil {
+		logErrorf("writing metrics textfile: %v", err)
+	}
+}
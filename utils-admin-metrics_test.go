@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApiOperation(t *testing.T) {
+	tests := []struct{ path, operation, endpoint string }{
+		{"/api/user/signup/", "signup", "/api/user/signup/"},
+		{"/api/user/login-code/", "loginCode", "/api/user/login-code/"},
+		{"/api/exim/01EXIM0000000000000000001", "getEximDetails", "/api/exim/{id}"},
+		{"/api/exims", "getExims", "/api/exims"},
+		{"/api/admin/bypass-email/01USER", "bypassEmail", "/api/admin/bypass-email/{id}"},
+		{"/api/admin/user/a@b.com/disable", "admin:user", "/api/admin/user"},
+		{"/favicon.ico", "other", "other"},
+	}
+	for _, tt := range tests {
+		op, endpoint := apiOperation(tt.path)
+		if op != tt.operation || endpoint != tt.endpoint {
+			t.Errorf("apiOperation(%s) = %s, %s; want %s, %s", tt.path, op, endpoint, tt.operation, tt.endpoint)
+		}
+	}
+}
+
+// Returns the value of the api request counter for the given labels.
+func apiRequestCount(t *testing.T, operation string, code string) float64 {
+	t.Helper()
+	families, err := adminMetrics.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "cp_admin_api_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if labelValue(m, []string{"operation"}) == operation && labelValue(m, []string{"code"}) == code {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestApiClientIsInstrumented(t *testing.T) {
+	f := newFakeApi(t)
+	before := apiRequestCount(t, "signup", "201")
+	failedBefore := apiRequestCount(t, "signup", "500")
+
+	signup("metrics@email.com")
+	f.setFault("/api/user/signup/", fakeFault{Status: http.StatusInternalServerError, Error: "boom"})
+	signup("metrics2@email.com")
+
+	if got := apiRequestCount(t, "signup", "201") - before; got != 1 {
+		t.Errorf("signup 201 count increased by %v, want 1", got)
+	}
+	if got := apiRequestCount(t, "signup", "500") - failedBefore; got != 1 {
+		t.Errorf("signup 500 count increased by %v, want 1", got)
+	}
+}
+
+func TestWriteMetricsTextfile(t *testing.T) {
+	newFakeApi(t)
+	getExims()
+	metricsTextfile = filepath.Join(t.TempDir(), "cp_admin.prom")
+	t.Cleanup(func() { metricsTextfile = "" })
+
+	writeMetricsTextfile()
+	data, err := os.ReadFile(metricsTextfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `cp_admin_api_requests_total{code="200",endpoint="/api/exims",operation="getExims"}`) {
+		t.Errorf("textfile missing getExims counter:\n%s", data)
+	}
+}
+
+func TestServeAdminMetrics(t *testing.T) {
+	newFakeApi(t)
+	getExims()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	serveAdminMetrics(addr)
+	var res *http.Response
+	for i := 0; i < 20; i++ {
+		if res, err = http.Get("http://" + addr + "/metrics"); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(body), "cp_admin_api_request_duration_seconds") {
+		t.Errorf("metrics missing duration histogram:\n%s", body)
+	}
+}
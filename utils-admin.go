@@ -5,134 +5,162 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
-// Shut down API server gracefully.
-func shutdown() {
-	url := "http://localhost:8000/api/admin/shutdown/"
-
+// Sends an admin GET request and decodes the JSON response into dst, whose
+// error field is returned via errMsg.
+func adminGet(url string, dst interface{}, errMsg *string) error {
 	// Create a new request using http.
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Printf("[err][admin] creating request: %v [%s]\n", err, cts())
+		logErrorf("creating request: %v", err)
 		os.Exit(1)
 	}
 
 	// Set custom admin auth header.
-	req.Header.Set("Admin-Authorization", adminAuthToken)
+	setAdminHeaders(req)
 
 	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
+	res, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("completing get request: %v", err)
 		os.Exit(1)
 	}
-	defer resp.Body.Close()
+	defer res.Body.Close()
 
-	// Read response body into memory so we can print it.
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("[err][admin] reading response body: %v [%s]\n", err, cts())
-		os.Exit(1)
-	}
+	logResponse(res)
 
-	fmt.Printf("[admin] response status: %s [%s]\n", resp.Status, cts())
-	fmt.Printf("[admin] response body: %s [%s]\n", body, cts())
+	unmarshalOrExit(res, dst)
+
+	// Check if the server returned an error message.
+	if *errMsg != "" {
+		logWarnf("api server returned error: %s", *errMsg)
+		return fmt.Errorf(*errMsg)
+	}
+	return nil
 }
 
-// Log USER_EMAIL bucket on API server.
-func logUserEmailBucket() {
-	url := "http://localhost:8000/api/admin/log-bucket-custom-key/USER_EMAIL"
+// Sends an admin request that is expected to return 204 (no content),
+// returning the server's error message otherwise, or errDryRun if the request
+// was skipped. Every call is recorded in the audit log.
+func adminDo(method string, url string) error {
+	var resBody errorResponse
+
+	if dryRunSkip("send %s %s", method, url) {
+		return errDryRun
+	}
 
 	// Create a new request using http.
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
-		fmt.Printf("[err][admin] creating request: %v [%s]\n", err, cts())
+		logErrorf("creating request: %v", err)
 		os.Exit(1)
 	}
 
 	// Set custom admin auth header.
-	req.Header.Set("Admin-Authorization", adminAuthToken)
+	setAdminHeaders(req)
 
 	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
+	res, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("sending request: %v", err)
 		os.Exit(1)
 	}
-	defer resp.Body.Close()
+	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", resp.Status, cts())
-}
+	logResponse(res)
 
-// Log USER_AUTH bucket on API server.
-func logUserAuthBucket() {
-	url := "http://localhost:8000/api/admin/log-bucket/USER_AUTH"
-	// Create a new request using http.
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		fmt.Printf("[err][admin] creating request: %v [%s]\n", err, cts())
-		os.Exit(1)
+	// A 204 status code (no content) is expected. If it's anything else,
+	// proceed with unmarshaling the response body to get the error.
+	if res.StatusCode != http.StatusNoContent {
+		unmarshalOrExit(res, &resBody)
+		logWarnf("api server returned error: %s", resBody.Error)
+		err = fmt.Errorf(resBody.Error)
 	}
 
-	// Set custom admin auth header.
-	req.Header.Set("Admin-Authorization", adminAuthToken)
-
-	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
-		os.Exit(1)
+	args := make(map[string]string)
+	for k, v := range req.URL.Query() {
+		args[k] = strings.Join(v, ",")
 	}
-	defer resp.Body.Close()
+	auditAction(fmt.Sprintf("admin %s %s", method, req.URL.Path), args, err)
+	return err
+}
 
-	fmt.Printf("[admin] response status: %s [%s]\n", resp.Status, cts())
+// Shut down API server gracefully.
+func shutdown() {
+	requestShutdown(apiBaseUrl, 0)
 }
 
-// Log ADMIN_EMAIL bucket on API server.
-func logAdminEmailBucket() {
-	url := "http://localhost:8000/api/admin/log-bucket/ADMIN_EMAIL"
+// Asks the API server at baseUrl to shut down. With a non-zero drain, the
+// server is asked to wait up to that long for in-flight requests to finish
+// first. Returns errDryRun if the request was skipped.
+func requestShutdown(baseUrl string, drain time.Duration) error {
+	url := baseUrl + "/api/admin/shutdown/"
+	if drain > 0 {
+		url += "?drain=" + drain.String()
+	}
+
+	if dryRunSkip("send POST %s", url) {
+		return errDryRun
+	}
+
 	// Create a new request using http.
 	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
-		fmt.Printf("[err][admin] creating request: %v [%s]\n", err, cts())
+		logErrorf("creating request: %v", err)
 		os.Exit(1)
 	}
 
 	// Set custom admin auth header.
-	req.Header.Set("Admin-Authorization", adminAuthToken)
+	setAdminHeaders(req)
 
 	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", resp.Status, cts())
-}
-
-// Log MOD_EXIM bucket on API server.
-func logModEximBucket() {
-	url := "http://localhost:8000/api/admin/log-bucket/MOD_EXIM"
-	// Create a new request using http.
-	req, err := http.NewRequest("POST", url, nil)
+	// Read response body into memory so we can print it.
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("[err][admin] creating request: %v [%s]\n", err, cts())
+		logErrorf("reading response body: %v", err)
 		os.Exit(1)
 	}
 
-	// Set custom admin auth header.
-	req.Header.Set("Admin-Authorization", adminAuthToken)
+	logResponse(resp)
+	logInfof("response body: %s", body)
 
-	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
-		os.Exit(1)
+	var result error
+	if resp.StatusCode >= 300 {
+		result = fmt.Errorf("%s", resp.Status)
 	}
-	defer resp.Body.Close()
+	auditAction("shutdown", map[string]string{"api": baseUrl, "drain": drain.String()}, result)
+	return result
+}
+
+// Get exims awaiting moderation (not yet approved).
+func getUnapprovedExims() ([]eximRecord, error) {
+	var resBody eximsResponse
+	err := adminGet(apiBaseUrl+"/api/admin/exims?approved=false", &resBody, &resBody.Error)
+	return resBody.Exims, err
+}
+
+// Approve or reject an exim. Action is the admin endpoint name, either
+// "approve-exim" or "reject-exim".
+func moderateExim(action string, eximId string) error {
+	return adminDo("POST", fmt.Sprintf("%s/api/admin/%s/%s", apiBaseUrl, action, eximId))
+}
+
+// Approve an exim so that it is publicly visible.
+func approveExim(eximId string) error {
+	return moderateExim("approve-exim", eximId)
+}
 
-	fmt.Printf("[admin] response status: %s [%s]\n", resp.Status, cts())
+// Reject an exim, removing it from the moderation queue.
+func rejectExim(eximId string) error {
+	return moderateExim("reject-exim", eximId)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestShutdown(t *testing.T) {
+	f := newFakeApi(t)
+	shutdown()
+	if f.shutdowns != 1 {
+		t.Errorf("shutdowns = %d, want 1", f.shutdowns)
+	}
+}
+
+func TestAdminAuthorizationRejected(t *testing.T) {
+	f := newFakeApi(t)
+	old := adminAuthToken
+	t.Cleanup(func() { adminAuthToken = old })
+
+	// Signature for a different message than the ulid.
+	adminAuthToken = testAdminUlid + "." + signMessage("someone else")
+	shutdown()
+	if _, err := getLoginCodeViaBypass("anyone"); err == nil {
+		t.Error("expected error from bypass-email with bad signature")
+	}
+	if f.shutdowns != 0 {
+		t.Errorf("shutdowns = %d, want 0", f.shutdowns)
+	}
+	if f.deniedCalls != 2 {
+		t.Errorf("deniedCalls = %d, want 2", f.deniedCalls)
+	}
+}
+
+func TestAdminFault(t *testing.T) {
+	f := newFakeApi(t)
+	f.setFault("/api/admin/", fakeFault{Status: http.StatusInternalServerError, Error: "boom"})
+	if _, err := getLoginCodeViaBypass("anyone"); err == nil || err.Error() != "boom" {
+		t.Errorf("err = %v, want boom", err)
+	}
+	if f.adminCalls != 0 {
+		t.Errorf("adminCalls = %d, want 0", f.adminCalls)
+	}
+}
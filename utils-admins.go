@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Local roster of admin identities and the directory holding their keys.
+var adminRosterPath = "admins.json"
+var adminKeyDir = "keys"
+
+// An admin identity cp-admin can act as. Each admin signs requests with their
+// own private key, which cp-api verifies against the public key registered
+// when the admin was created.
+type adminIdentity struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	AdminId   string    `json:"adminId"`
+	KeyFile   string    `json:"keyFile"`
+	RevokedTs time.Time `json:"revokedTs,omitempty"`
+}
+
+type adminRoster struct {
+	// Name of the admin selected last; used when no -admin flag is given.
+	Acting string          `json:"acting"`
+	Admins []adminIdentity `json:"admins"`
+}
+
+// The admin whose key signs every admin request.
+var actingAdmin adminIdentity
+
+var adminNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func (a adminIdentity) revoked() bool {
+	return !a.RevokedTs.IsZero()
+}
+
+func (r *adminRoster) find(name string) *adminIdentity {
+	for i := range r.Admins {
+		if r.Admins[i].Name == name {
+			return &r.Admins[i]
+		}
+	}
+	return nil
+}
+
+// Reads the admin roster. When no roster exists yet it is started with the
+// original admin from ADMIN_ONE_EMAIL/ADMIN_ONE_ULID, signing with cp.pem.
+func loadAdminRoster() (adminRoster, error) {
+	var roster adminRoster
+	data, err := os.ReadFile(adminRosterPath)
+	if os.IsNotExist(err) {
+		ulid := os.Getenv("ADMIN_ONE_ULID")
+		if ulid == "" {
+			return roster, fmt.Errorf("no admin roster at %s and env variable ADMIN_ONE_ULID is not set", adminRosterPath)
+		}
+		roster = adminRoster{
+			Acting: "admin-one",
+			Admins: []adminIdentity{{Name: "admin-one", Email: os.Getenv("ADMIN_ONE_EMAIL"), AdminId: ulid, KeyFile: "cp.pem"}},
+		}
+		return roster, saveAdminRoster(roster)
+	}
+	if err != nil {
+		return roster, err
+	}
+	if err := json.Unmarshal(data, &roster); err != nil {
+		return roster, fmt.Errorf("parsing %s: %v", adminRosterPath, err)
+	}
+	return roster, nil
+}
+
+func saveAdminRoster(roster adminRoster) error {
+	data, err := json.MarshalIndent(roster, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(adminRosterPath, append(data, '\n'), 0600)
+}
+
+// Makes the named admin the acting admin: loads their key, re-signs the admin
+// auth token and remembers the choice in the roster.
+func setActingAdmin(name string) error {
+	roster, err := loadAdminRoster()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = roster.Acting
+	}
+	admin := roster.find(name)
+	if admin == nil {
+		return fmt.Errorf("no admin named %q in %s", name, adminRosterPath)
+	}
+	if admin.revoked() {
+		return fmt.Errorf("admin %q was revoked on %s", name, admin.RevokedTs.Format(time.RFC3339))
+	}
+	key, err := readPrivateKeyFile(admin.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	cpPrivateKey = key
+	actingAdmin = *admin
+	setAdminAuthToken()
+
+	if roster.Acting != name {
+		roster.Acting = name
+		return saveAdminRoster(roster)
+	}
+	return nil
+}
+
+// Registers a new admin with the API server, signed by the acting admin. A
+// fresh key pair is generated for them under adminKeyDir.
+func createAdmin(name string, email string) (adminIdentity, error) {
+	if !adminNamePattern.MatchString(name) {
+		return adminIdentity{}, fmt.Errorf("admin name %q must be lowercase letters, digits and dashes", name)
+	}
+	roster, err := loadAdminRoster()
+	if err != nil {
+		return adminIdentity{}, err
+	}
+	if roster.find(name) != nil {
+		return adminIdentity{}, fmt.Errorf("admin %q already exists", name)
+	}
+
+	if err := os.MkdirAll(adminKeyDir, 0700); err != nil {
+		return adminIdentity{}, err
+	}
+	keyFile := filepath.Join(adminKeyDir, name+".pem")
+	key, err := writeNewPrivateKey(keyFile)
+	if err != nil {
+		return adminIdentity{}, err
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey),
+	})
+
+	adminId, err := registerAdmin(email, publicKeyPEM)
+	auditAction("create admin", map[string]string{"name": name, "email": email, "adminId": adminId}, err)
+	if err != nil {
+		os.Remove(keyFile)
+		return adminIdentity{}, err
+	}
+	admin := adminIdentity{Name: name, Email: email, AdminId: adminId, KeyFile: keyFile}
+	roster.Admins = append(roster.Admins, admin)
+	return admin, saveAdminRoster(roster)
+}
+
+// Posts a new admin's email and public key, returning their admin ULID.
+func registerAdmin(email string, publicKeyPEM []byte) (string, error) {
+	var resBody createAdminResponse
+	jsonData, _ := json.Marshal(map[string]string{"email": email, "publicKey": string(publicKeyPEM)})
+
+	req, err := http.NewRequest("POST", apiBaseUrl+"/api/admin/admins", bytes.NewBuffer(jsonData))
+	if err != nil {
+		logErrorf("creating request: %v", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAdminHeaders(req)
+
+	res, err := apiClient.Do(req)
+	if err != nil {
+		logErrorf("posting request: %v", err)
+		os.Exit(1)
+	}
+	defer res.Body.Close()
+
+	logResponse(res)
+
+	unmarshalOrExit(res, &resBody)
+
+	if resBody.Error != "" {
+		logWarnf("api server returned error: %s", resBody.Error)
+		return "", fmt.Errorf(resBody.Error)
+	}
+	return resBody.AdminId, nil
+}
+
+// Revokes an admin on the API server so their key is no longer accepted, and
+// marks them revoked in the roster. The acting admin cannot revoke themself.
+func revokeAdmin(name string) error {
+	roster, err := loadAdminRoster()
+	if err != nil {
+		return err
+	}
+	admin := roster.find(name)
+	if admin == nil {
+		return fmt.Errorf("no admin named %q in %s", name, adminRosterPath)
+	}
+	if admin.revoked() {
+		return fmt.Errorf("admin %q is already revoked", name)
+	}
+	if admin.AdminId == actingAdmin.AdminId {
+		return fmt.Errorf("cannot revoke the acting admin; select another admin first")
+	}
+
+	err = adminDo("DELETE", fmt.Sprintf("%s/api/admin/admins/%s", apiBaseUrl, neturl.PathEscape(admin.AdminId)))
+	if err != nil {
+		return err
+	}
+	admin.RevokedTs = time.Now().UTC()
+	return saveAdminRoster(roster)
+}
+
+func printAdminRoster(roster adminRoster) {
+	fmt.Printf("\n%-4s %-16s %-28s %-26s %s\n", "#", "NAME", "EMAIL", "ADMIN ID", "STATUS")
+	for i, a := range roster.Admins {
+		status := "active"
+		if a.revoked() {
+			status = "revoked " + a.RevokedTs.Format("2006-01-02")
+		}
+		if a.Name == actingAdmin.Name {
+			status += " (acting)"
+		}
+		fmt.Printf("%-4d %-16s %-28s %-26s %s\n", i+1, a.Name, a.Email, a.AdminId, status)
+	}
+}
+
+// Lists the roster and switches the acting admin to the chosen one.
+func selectActingAdmin() {
+	roster, err := loadAdminRoster()
+	if err != nil {
+		logErrorf("loading admin roster: %v", err)
+		return
+	}
+	printAdminRoster(roster)
+	input := promptWithDefault("Act as admin # or name", actingAdmin.Name)
+	name := input
+	if i, err := strconv.Atoi(input); err == nil && i >= 1 && i <= len(roster.Admins) {
+		name = roster.Admins[i-1].Name
+	}
+	if err := setActingAdmin(name); err != nil {
+		logErrorf("selecting admin: %v", err)
+		return
+	}
+	logInfof("now acting as %s (%s)", actingAdmin.Name, actingAdmin.AdminId)
+}
+
+// Prompts for a new admin's name and email and registers them.
+func runCreateAdmin() {
+	name := promptLine("New admin name (e.g. jane): ")
+	email := promptLine("New admin email: ")
+	if dryRunSkip("generate a key in %s and send POST %s/api/admin/admins for %s <%s>", adminKeyDir, apiBaseUrl, name, email) {
+		return
+	}
+	admin, err := createAdmin(name, email)
+	if err != nil {
+		logErrorf("creating admin: %v", err)
+		return
+	}
+	logInfof("created admin %s (%s) with key %s", admin.Name, admin.AdminId, admin.KeyFile)
+}
+
+// Prompts for an admin to revoke and confirms by name.
+func runRevokeAdmin() {
+	roster, err := loadAdminRoster()
+	if err != nil {
+		logErrorf("loading admin roster: %v", err)
+		return
+	}
+	printAdminRoster(roster)
+	name := promptLine("Admin name to revoke (blank to cancel): ")
+	if name == "" {
+		return
+	}
+	if !confirmDestructive("revoke admin "+name, name) {
+		return
+	}
+	if err := revokeAdmin(name); err != nil {
+		logErrorf("revoking admin: %v", err)
+		return
+	}
+	logInfof("revoked admin %s", name)
+}
+
+// Sets the admin auth header on req, identifying the acting admin, and notes
+// who the call is made as.
+func setAdminHeaders(req *http.Request) {
+	req.Header.Set("Admin-Authorization", adminAuthToken)
+	logInfof("%s %s as %s", req.Method, req.URL.Path, actingAdmin.Name)
+}
+
+// Returns the private key stored in a PEM file.
+func readPrivateKeyFile(path string) (*rsa.PrivateKey, error) {
+	privateKeyPEM, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("private key file %s is not present; use Provision Local menu to generate and copy to api server", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading private key file: %v", err)
+	}
+
+	// Decode the PEM file into a private key.
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("decoding PEM block containing private key in %s", path)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing encoded private key: %v", err)
+	}
+	return key, nil
+}
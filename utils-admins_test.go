@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Points the admin roster and key directory at a temp dir holding a roster
+// with the test admin, restoring the acting admin afterwards.
+func withAdminRoster(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	oldRoster, oldKeys := adminRosterPath, adminKeyDir
+	oldAdmin, oldKey, oldToken := actingAdmin, cpPrivateKey, adminAuthToken
+	adminRosterPath = filepath.Join(dir, "admins.json")
+	adminKeyDir = filepath.Join(dir, "keys")
+	t.Cleanup(func() {
+		adminRosterPath, adminKeyDir = oldRoster, oldKeys
+		actingAdmin, cpPrivateKey, adminAuthToken = oldAdmin, oldKey, oldToken
+	})
+
+	keyFile := filepath.Join(dir, "test-admin.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(cpPrivateKey)})
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	roster := adminRoster{Acting: "test-admin", Admins: []adminIdentity{{Name: "test-admin", Email: "admin@email.com", AdminId: testAdminUlid, KeyFile: keyFile}}}
+	if err := saveAdminRoster(roster); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAdminRosterBootstrapsFromEnv(t *testing.T) {
+	adminRosterPath = filepath.Join(t.TempDir(), "admins.json")
+	t.Cleanup(func() { adminRosterPath = "admins.json" })
+	t.Setenv("ADMIN_ONE_EMAIL", "one@email.com")
+	t.Setenv("ADMIN_ONE_ULID", testAdminUlid)
+
+	roster, err := loadAdminRoster()
+	if err != nil {
+		t.Fatalf("loadAdminRoster: %v", err)
+	}
+	a := roster.find("admin-one")
+	if roster.Acting != "admin-one" || a == nil || a.AdminId != testAdminUlid || a.Email != "one@email.com" || a.KeyFile != "cp.pem" {
+		t.Errorf("roster = %+v", roster)
+	}
+	if _, err := os.Stat(adminRosterPath); err != nil {
+		t.Errorf("roster was not saved: %v", err)
+	}
+}
+
+func TestCreateActAsAndRevokeAdmin(t *testing.T) {
+	f := newFakeApi(t)
+	withAdminRoster(t)
+	if err := setActingAdmin(""); err != nil {
+		t.Fatalf("setActingAdmin: %v", err)
+	}
+
+	jane, err := createAdmin("jane", "jane@email.com")
+	if err != nil {
+		t.Fatalf("createAdmin: %v", err)
+	}
+	if f.admins[jane.AdminId] == nil || f.admins[jane.AdminId].Email != "jane@email.com" {
+		t.Fatalf("admin not registered with api: %+v", f.admins)
+	}
+	if _, err := createAdmin("jane", "jane@email.com"); err == nil {
+		t.Error("expected error creating duplicate admin")
+	}
+
+	// Calls made as jane are signed with her key and attributed to her.
+	if err := setActingAdmin("jane"); err != nil {
+		t.Fatalf("setActingAdmin(jane): %v", err)
+	}
+	shutdown()
+	if f.callsByAdmin[jane.AdminId] != 1 || f.deniedCalls != 0 {
+		t.Errorf("callsByAdmin = %v, denied %d", f.callsByAdmin, f.deniedCalls)
+	}
+	if roster, _ := loadAdminRoster(); roster.Acting != "jane" {
+		t.Errorf("acting admin not remembered: %q", roster.Acting)
+	}
+
+	if err := revokeAdmin("jane"); err == nil {
+		t.Error("expected error revoking the acting admin")
+	}
+	if err := setActingAdmin("test-admin"); err != nil {
+		t.Fatal(err)
+	}
+	withInput(t, "jane", "jane")
+	runRevokeAdmin()
+	if !f.admins[jane.AdminId].Revoked {
+		t.Error("admin was not revoked on the api")
+	}
+	if err := setActingAdmin("jane"); err == nil {
+		t.Error("expected error acting as a revoked admin")
+	}
+}
+
+func TestSelectActingAdmin(t *testing.T) {
+	newFakeApi(t)
+	withAdminRoster(t)
+	if err := setActingAdmin(""); err != nil {
+		t.Fatal(err)
+	}
+	jane, err := createAdmin("jane", "jane@email.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withInput(t, "2")
+	selectActingAdmin()
+	if actingAdmin.AdminId != jane.AdminId {
+		t.Errorf("acting admin = %+v, want jane", actingAdmin)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"os"
 	"strings"
@@ -14,111 +13,112 @@ import (
 var str = "a ability able about above accept according account across act action activity actually add address administration admit adult affect after again against age agency agent ago agree agreement ahead air all allow almost alone along already also although always American among amount analysis and animal another answer any anyone anything appear apply approach area argue arm around arrive art article artist as ask assume at attention attorney audience author authority available avoid away back bad bag ball bank bar base be beat beautiful because become bed before begin behavior behind believe benefit best better between beyond big bill billion bit black blood blue board body book born both box boy break bring brother budget build building business but buy by call camera campaign can cancer candidate capital car card care career carry case catch cause cell center central century certain certainly chair challenge chance change character charge check child choice choose church citizen city civil claim class clear clearly close coach cold collection college color come commercial common community company compare computer concern condition conference Congress consider consumer contain continue control cost could country couple course court cover create crime cultural culture cup current customer cut dark data daughter day dead deal debate decade decide decision deep defense degree democratic describe design despite detail determine develop development difference different difficult dinner direction director discover discuss discussion disease do doctor dog door down draw dream drive drop drug during each early east easy eat economic economy edge education effect effort eight either election else employee end energy enjoy enough enter entire environment environmental especially establish even evening event ever every everybody everyone everything evidence exactly example executive exist expect experience expert explain eye face fact factor fail fall family far fast father fear federal feel feeling few field fight figure fill film final finally financial find fine finger finish fire firm first fish five floor fly focus follow food foot for force foreign forget form former forward four free friend from front full fund future game garden gas general generation get girl give glass go goal good government great green ground group grow growth guess gun guy hair half hand hang happen happy hard have he head health hear heart heat heavy help her here herself high him himself his history hit hold home hope hospital hot hotel hour house how however huge human hundred husband idea identify if image imagine impact important improve in include including increase indeed indicate individual industry information inside instead institution interest interesting international interview into investment involve issue it item its itself job join just keep key kid kind kitchen know knowledge land language large last late later laugh law lawyer lay lead leader learn least leave left leg legal less let letter level lie life light like likely line list listen little live local long look lose loss lot love low machine magazine main maintain major majority make man manage management manager many market marriage material matter may maybe mean measure media medical meet meeting member memory mention message method middle might military million mind minute miss mission model modern moment money month more morning most mother mouth move movement movie much music must my myself name nation national natural nature near nearly necessary need network never new news newspaper next nice night no none nor north not note nothing notice now number occur of off offer office officer official often oh oil ok old on once one only onto open operation opportunity option or order organization other others our out outside over own owner page pain painting paper parent part participant particular particularly partner party pass past patient pattern pay peace people per perform performance perhaps period person personal phone physical pick picture piece place plan plant play player PM point police policy political politics poor popular population position positive possible power practice prepare present president pressure pretty prevent price private probably problem process produce product production professional professor program project property protect prove provide public pull purpose push put quality question quickly quite race radio raise range rate rather reach read ready real reality realize really reason receive recent recently recognize record red reduce reflect region relate relationship religious remain remember remove report represent require research resource respond response responsibility rest result return reveal rich right rise risk road rock role room rule run safe same save say scene school science scientist score sea season seat second section security see seek seem sell send senior sense series serious serve service set seven several shake share she shoot short shot should shoulder show side sign significant similar simple simply since sing single sister sit site situation six size skill skin small smile so social society soldier some somebody someone something sometimes son song soon sort sound source south southern space speak special specific speech spend sport spring staff stage stand standard star start state statement station stay step still stock stop store story strategy street strong structure student study stuff style subject success successful such suddenly suffer suggest summer support sure surface system table take talk task tax teach teacher team technology television tell ten tend term test than thank that the their them themselves then theory there these they thing think third this those though thought thousand threat three through throughout throw thus time to today together tonight too top total tough toward town trade traditional training travel treat treatment tree trial trip trouble true truth try turn TV two type under understand unit until up upon us use usually value various very victim view violence visit voice vote wait walk wall want war watch water way we weapon wear week weight well west western what whatever when where whether which while white who whole whom whose why wide wife will win wind window wish with within without woman wonder word work worker world worry would write writer wrong yard yeah year yes yet you young your yourself"
 var words = strings.Fields(str)
 
-// Manually test with hard-coded values. If set to empty strings, they will be
-// set in-memory by other cp-admin functions.
-var testEmail = ""
-var testUserId = ""
-var testToken = ""
-var testEximId = ""
-
-// Manually test with hard-coded value. If set to 0, the login code will be
-// retrieved from the api server (admin email bypass).
-var testLoginCode = 0
-
-// TODO: Remove the above variables and related functionality once things are
-// covered in E2E tests.
-
+// Returns a random email address that has not been generated before in this
+// run, so concurrent callers (e.g. load tests) never collide on signup.
 func generateRandomEmailAddress() string {
-	source := rand.NewSource(time.Now().UnixNano())
-	rng := rand.New(source)
-	return words[rng.Intn(len(words))] + words[rng.Intn(len(words))] + words[rng.Intn(len(words))] + "@email.com"
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	// Word combinations can repeat, so a run-wide counter keeps each address
+	// unique. Words have no digits, so the counter can't run into them.
+	emailCount++
+	return fmt.Sprintf("%s%s%s%d@email.com", words[dataRng.Intn(len(words))], words[dataRng.Intn(len(words))], words[dataRng.Intn(len(words))], emailCount)
 }
 
 func generatePlaceholderText(numWords int) string {
-	source := rand.NewSource(time.Now().UnixNano())
-	rng := rand.New(source)
+	dataMu.Lock()
+	defer dataMu.Unlock()
 	result := ""
 	for i := 0; i < numWords; i++ {
-		result += words[rng.Intn(len(words))] + " "
+		result += words[dataRng.Intn(len(words))] + " "
 	}
 	return result
 }
 
 func generatePlaceholderLink(numWords int) string {
-	source := rand.NewSource(time.Now().UnixNano())
-	rng := rand.New(source)
+	dataMu.Lock()
+	defer dataMu.Unlock()
 	result := ""
 	for i := 0; i < numWords; i++ {
-		result += words[rng.Intn(len(words))]
+		result += words[dataRng.Intn(len(words))]
 	}
 	return result
 }
 
 func signup(email string) (string, error) {
-	type ResponseBody struct {
-		UserId string `json:"userId"`
-		Error  string `json:"error"`
-	}
-	var resBody ResponseBody
-	var url = "http://localhost:8000/api/user/signup/"
+	var resBody signupResponse
+	var url = apiBaseUrl + "/api/user/signup/"
 	var jsonData = []byte(`{"email":"` + email + `"}`)
 
-	// Send POST request using the default http client.
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if dryRunSkip("send POST %s for %s", url, email) {
+		return "", errDryRun
+	}
+
+	// Send POST request using the api client.
+	res, err := apiClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
+		logWarnf("api server returned error: %s", resBody.Error)
 		return resBody.UserId, fmt.Errorf(resBody.Error)
 	}
 
 	return resBody.UserId, nil
 }
 
+// Signs up a new user with a random email and makes them the active test user.
 func wrappedSignup() {
-	if testEmail == "" {
-		testEmail = generateRandomEmailAddress()
+	store, err := loadSessionStore()
+	if err != nil {
+		logErrorf("loading sessions: %v", err)
+		return
+	}
+	email := generateRandomEmailAddress()
+	userId, err := signup(email)
+	if err != nil {
+		return
 	}
-	var err error
-	testUserId, err = signup(testEmail)
+	u, err := store.add("", email)
 	if err != nil {
+		logErrorf("%v", err)
 		return
 	}
-	fmt.Printf("[admin] successfully signed up email: %s, with userId: %s [%s]\n", testEmail, testUserId, cts())
+	u.UserId = userId
+	saveSessionStoreOrLog(store)
+	logInfof("successfully signed up email: %s, with userId: %s, as test user %s", email, userId, u.Name)
 }
 
 func login(email string) (string, error) {
-	type ResponseBody struct {
-		UserId string `json:"userId"`
-		Error  string `json:"error"`
-	}
-	var resBody ResponseBody
-	var url = "http://localhost:8000/api/user/login/"
+	var resBody loginResponse
+	var url = apiBaseUrl + "/api/user/login/"
 	var jsonData = []byte(fmt.Sprintf(`{"email":"%s"}`, email))
 
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if dryRunSkip("send POST %s for %s", url, email) {
+		return "", errDryRun
+	}
+
+	res, err := apiClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
+		logWarnf("api server returned error: %s", resBody.Error)
 		return resBody.UserId, fmt.Errorf(resBody.Error)
 	}
 
@@ -126,55 +126,50 @@ func login(email string) (string, error) {
 }
 
 func wrappedLogin() {
-	if testEmail == "" {
-		fmt.Printf("[err][admin] no hardcoded test email - add email or signup a new user first [%s]\n", cts())
+	store, u, ok := loadActiveUser()
+	if !ok {
 		return
 	}
-	var err error
-	testUserId, err = login(testEmail)
+	userId, err := login(u.Email)
 	if err != nil {
 		return
 	}
-	fmt.Printf("[admin] email: %s, userId: %s [%s]\n", testEmail, testUserId, cts())
+	u.UserId = userId
+	saveSessionStoreOrLog(store)
+	logInfof("email: %s, userId: %s", u.Email, u.UserId)
 }
 
 // Get a loginCode for a given userId by posting a request to a restricted
 // endpoint called bypass-email. Normally a code is emailed to users.
 func getLoginCodeViaBypass(userId string) (int, error) {
-	type ResponseBody struct {
-		LoginCode     int       `json:"loginCode"`
-		LoginAttempts int       `json:"loginAttempts"`
-		LogoutTs      time.Time `json:"logoutTs"`
-		Error         string    `json:"error"`
-	}
-	var resBody ResponseBody
-	var url = fmt.Sprintf("http://localhost:8000/api/admin/bypass-email/%s", userId)
+	var resBody bypassEmailResponse
+	var url = fmt.Sprintf("%s/api/admin/bypass-email/%s", apiBaseUrl, userId)
 
 	// Create a new request using http.
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Printf("[err][admin] creating request: %v [%s]\n", err, cts())
+		logErrorf("creating request: %v", err)
 		os.Exit(1)
 	}
 
 	// Set custom admin auth header.
-	req.Header.Set("Admin-Authorization", adminAuthToken)
+	setAdminHeaders(req)
 
 	// Send the request.
-	res, err := http.DefaultClient.Do(req)
+	res, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
+		logWarnf("api server returned error: %s", resBody.Error)
 		return resBody.LoginCode, fmt.Errorf(resBody.Error)
 	}
 
@@ -182,29 +177,28 @@ func getLoginCodeViaBypass(userId string) (int, error) {
 }
 
 func loginCode(userId string, code int) (string, int, error) {
-	type ResponseBody struct {
-		Token             string `json:"token"`
-		RemainingAttempts int    `json:"remainingAttempts"`
-		Error             string `json:"error"`
-	}
-	var resBody ResponseBody
-	var url = "http://localhost:8000/api/user/login-code/"
+	var resBody loginCodeResponse
+	var url = apiBaseUrl + "/api/user/login-code/"
 	var jsonData = []byte(fmt.Sprintf(`{"userId":"%s","code":%d}`, userId, code))
-	// Send POST request using the default http client.
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+
+	if dryRunSkip("send POST %s for %s", url, userId) {
+		return "", 0, errDryRun
+	}
+	// Send POST request using the api client.
+	res, err := apiClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
+		logWarnf("api server returned error: %s", resBody.Error)
 		return "", resBody.RemainingAttempts, fmt.Errorf(resBody.Error)
 	}
 
@@ -212,71 +206,62 @@ func loginCode(userId string, code int) (string, int, error) {
 }
 
 func wrappedLoginCode() {
-	// Check to make sure testUserId is set.
-	if testUserId == "" {
-		fmt.Printf("[err][admin] no hard-coded test userId - add manually, or signup/login a new user first [%s]\n", cts())
+	store, u, ok := loadActiveUser()
+	if !ok {
+		return
+	}
+	if u.UserId == "" {
+		logErrorf("test user %s has no userId - signup/login first", u.Name)
 		return
 	}
 
-	// No hard-coded testLoginCode. Get code from the server.
-	if testLoginCode == 0 {
+	// No stored login code. Get one from the server.
+	code := u.LoginCode
+	if code == 0 {
 		var err error
-		testLoginCode, err = getLoginCodeViaBypass(testUserId)
+		code, err = getLoginCodeViaBypass(u.UserId)
 		if err != nil {
 			return
 		}
 	}
 
 	// Proceed with api call to login-code.
-	var err error
-	var attempts int
-	testToken, attempts, err = loginCode(testUserId, testLoginCode)
+	token, attempts, err := loginCode(u.UserId, code)
 	if err != nil {
-		fmt.Printf("[admin] userId: %s, remainingAttempts: %d [%s]\n", testUserId, attempts, cts())
+		logInfof("userId: %s, remainingAttempts: %d", u.UserId, attempts)
 		return
 	}
+	u.Token = token
+	u.LoggedInTs = time.Now().UTC()
+	saveSessionStoreOrLog(store)
 
-	fmt.Printf("[admin] userId: %s, token: %s [%s]\n", testUserId, testToken, cts())
+	logInfof("userId: %s, token: %s", u.UserId, u.Token)
 }
 
+// Creates an exim filled with random, placeholder text.
 func createExim(authToken string) string {
-	type RequestBody struct {
-		Target     string `json:"target"`
-		Title      string `json:"title"`
-		Summary    string `json:"summary"`
-		Paragraph1 string `json:"paragraph1"`
-		Paragraph2 string `json:"paragraph2"`
-		Paragraph3 string `json:"paragraph3"`
-		Link       string `json:"link"`
-	}
-	type ResponseBody struct {
-		EximId string `json:"eximId"`
-		Error  string `json:"error"`
-	}
-	var reqBody RequestBody
-	var resBody ResponseBody
-	var url = "http://localhost:8000/api/exim/create/"
-
-	// Fill Exim with random, placeholder text.
-	reqBody.Target = "FEDERAL"
-	reqBody.Title = generatePlaceholderText(5)
-	reqBody.Summary = generatePlaceholderText(20)
-	reqBody.Paragraph1 = generatePlaceholderText(40)
-	reqBody.Paragraph2 = generatePlaceholderText(40)
-	reqBody.Paragraph3 = generatePlaceholderText(40)
-	reqBody.Link = fmt.Sprintf("https://%s.com", generatePlaceholderLink(3))
+	return createEximWithFields(authToken, generateEximFields(eximDataTypical))
+}
+
+func createEximWithFields(authToken string, reqBody eximFields) string {
+	var resBody createEximResponse
+	var url = apiBaseUrl + "/api/exim/create/"
+
+	if dryRunSkip("send POST %s", url) {
+		return ""
+	}
 
 	// Marshal the request body to JSON.
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		fmt.Printf("[err][admin] marshaling request body: %v [%s]\n", err, cts())
+		logErrorf("marshaling request body: %v", err)
 		os.Exit(1)
 	}
 
 	// Create a new request using http.
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[err][admin] creating new request: %v [%s]\n", err, cts())
+		logErrorf("creating new request: %v", err)
 		os.Exit(1)
 	}
 
@@ -286,136 +271,142 @@ func createExim(authToken string) string {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request.
-	res, err := http.DefaultClient.Do(req)
+	res, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
+		logWarnf("api server returned error: %s", resBody.Error)
 	} else {
-		fmt.Printf("[admin] ulid of new exim: %s [%s]\n", resBody.EximId, cts())
+		logInfof("ulid of new exim: %s", resBody.EximId)
 	}
 
 	return resBody.EximId
 }
 
 func wrappedCreateExim() {
-	if testToken == "" {
-		fmt.Printf("[err][admin] no hard-coded test token - login first [%s]\n", cts())
+	store, u, ok := loadActiveUser()
+	if !ok {
 		return
 	}
-	testEximId = createExim(testToken)
+	if u.Token == "" {
+		logErrorf("test user %s has no token - login first", u.Name)
+		return
+	}
+	if eximId := createExim(u.Token); eximId != "" {
+		u.Exims = append(u.Exims, eximId)
+		saveSessionStoreOrLog(store)
+	}
 }
 
 func getEximDetails(eximId string) {
-	type ResponseBody struct {
-		EximId     string `json:"eximId"`
-		Author     string `json:"author"`
-		IsApproved bool   `json:"isApproved"`
-		Target     string `json:"target"`
-		Title      string `json:"title"`
-		Summary    string `json:"summary"`
-		Paragraph1 string `json:"paragraph1"`
-		Paragraph2 string `json:"paragraph2"`
-		Paragraph3 string `json:"paragraph3"`
-		Link       string `json:"link"`
-		Error      string `json:"error"`
-	}
-	var resBody ResponseBody
-	var url = fmt.Sprintf("http://localhost:8000/api/exim/%s", eximId)
-
-	// Send GET request using the default http client.
-	res, err := http.Get(url)
+	var resBody eximDetailsResponse
+	var url = fmt.Sprintf("%s/api/exim/%s", apiBaseUrl, eximId)
+
+	// Send GET request using the api client.
+	res, err := apiClient.Get(url)
 	if err != nil {
-		fmt.Printf("[err][admin] completing get request: %v [%s]\n", err, cts())
+		logErrorf("completing get request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
+		logWarnf("api server returned error: %s", resBody.Error)
 	} else {
-		fmt.Printf("[admin] got exim details (title as follows): %v [%s]\n", resBody.Title, cts())
+		logInfof("got exim details (title as follows): %v", resBody.Title)
 	}
 }
 
+// Gets the details of the exim the active test user created last.
 func wrappedGetEximDetails() {
-	if testEximId == "" {
-		fmt.Printf("[err][admin] no hard-coded test eximId - create an exim first [%s]\n", cts())
+	_, u, ok := loadActiveUser()
+	if !ok {
+		return
+	}
+	if len(u.Exims) == 0 {
+		logErrorf("test user %s has no exims - create an exim first", u.Name)
 		return
 	}
-	getEximDetails(testEximId)
+	getEximDetails(u.Exims[len(u.Exims)-1])
 }
 
-func getExims() {
-	type Exim struct {
-		EximId     string `json:"eximId"`
-		Author     string `json:"author"`
-		IsApproved bool   `json:"isApproved"`
-		Target     string `json:"target"`
-		Title      string `json:"title"`
-		Summary    string `json:"summary"`
-		Paragraph1 string `json:"paragraph1"`
-		Paragraph2 string `json:"paragraph2"`
-		Paragraph3 string `json:"paragraph3"`
-		Link       string `json:"link"`
-	}
-	type ResponseBody struct {
-		Exims []Exim `json:"exims"`
-		Error string `json:"error"`
-	}
-
-	var resBody ResponseBody
-	var url = "http://localhost:8000/api/exims"
-
-	// Send GET request using the default http client.
-	res, err := http.Get(url)
+// An exim as returned by the api server.
+type eximRecord struct {
+	EximId     string `json:"eximId"`
+	Author     string `json:"author"`
+	IsApproved bool   `json:"isApproved"`
+	Target     string `json:"target"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary"`
+	Paragraph1 string `json:"paragraph1"`
+	Paragraph2 string `json:"paragraph2"`
+	Paragraph3 string `json:"paragraph3"`
+	Link       string `json:"link"`
+}
+
+// Gets every exim the api server lists.
+func fetchExims() ([]eximRecord, error) {
+	var resBody eximsResponse
+	var url = apiBaseUrl + "/api/exims"
+
+	// Send GET request using the api client.
+	res, err := apiClient.Get(url)
 	if err != nil {
-		fmt.Printf("[err][admin] completing get request: %v [%s]\n", err, cts())
+		logErrorf("completing get request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
-	unmarshalOrExit(res.Body, &resBody)
+	unmarshalOrExit(res, &resBody)
 
 	// Check if the server returned an error message.
 	if resBody.Error != "" {
-		fmt.Printf("[admin] api server returned error: %s [%s]\n", resBody.Error, cts())
-	} else {
-		// Range over resBody.Exims and print the title of each exim.
-		for _, exim := range resBody.Exims {
-			fmt.Printf("[admin] exim title: %s [%s]\n", exim.Title, cts())
-		}
+		logWarnf("api server returned error: %s", resBody.Error)
+		return nil, fmt.Errorf(resBody.Error)
 	}
+	return resBody.Exims, nil
 }
 
-func logout(authToken string, userId string) error {
-	type ResponseBody struct {
-		Error string `json:"error"`
+func getExims() {
+	exims, err := fetchExims()
+	if err != nil {
+		return
+	}
+	// Range over the exims and print the title of each.
+	for _, exim := range exims {
+		logInfof("exim title: %s", exim.Title)
 	}
-	var resBody ResponseBody
-	url := "http://localhost:8000/api/user/logout/"
+}
+
+func logout(authToken string, userId string) error {
+	var resBody errorResponse
+	url := apiBaseUrl + "/api/user/logout/"
 	jsonData := []byte(fmt.Sprintf(`{"userId":"%s"}`, userId))
 
+	if dryRunSkip("send POST %s for %s", url, userId) {
+		return errDryRun
+	}
+
 	// Create a new request using http.
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[err][admin] creating new request: %v [%s]\n", err, cts())
+		logErrorf("creating new request: %v", err)
 		os.Exit(1)
 	}
 
@@ -425,20 +416,20 @@ func logout(authToken string, userId string) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request.
-	res, err := http.DefaultClient.Do(req)
+	res, err := apiClient.Do(req)
 	if err != nil {
-		fmt.Printf("[err][admin] posting request: %v [%s]\n", err, cts())
+		logErrorf("posting request: %v", err)
 		os.Exit(1)
 	}
 	defer res.Body.Close()
 
-	fmt.Printf("[admin] response status: %s [%s]\n", res.Status, cts())
+	logResponse(res)
 
 	// A 204 status code (no content) is expected. If it's anything else,
 	// proceed with unmarshaling the response body to get the error.
 	if res.StatusCode != http.StatusNoContent {
-		unmarshalOrExit(res.Body, &resBody)
-		fmt.Printf("[admin] server returned error: %s [%s]\n", resBody.Error, cts())
+		unmarshalOrExit(res, &resBody)
+		logInfof("server returned error: %s", resBody.Error)
 		return fmt.Errorf(resBody.Error)
 	}
 
@@ -446,13 +437,19 @@ func logout(authToken string, userId string) error {
 }
 
 func wrappedLogout() {
-	if testToken == "" {
-		fmt.Printf("[err][admin] no hard-coded test token - login first [%s]\n", cts())
+	store, u, ok := loadActiveUser()
+	if !ok {
+		return
+	}
+	if u.Token == "" {
+		logErrorf("test user %s has no token - login first", u.Name)
 		return
 	}
-	err := logout(testToken, testUserId)
+	err := logout(u.Token, u.UserId)
 	if err != nil {
 		return
 	}
-	fmt.Printf("[admin] test user successfully logged out [%s]\n", cts())
+	u.Token = ""
+	saveSessionStoreOrLog(store)
+	logInfof("test user %s successfully logged out", u.Name)
 }
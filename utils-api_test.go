@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Points the session store at an empty directory for the test.
+func resetTestUser(t *testing.T) {
+	t.Helper()
+	old := sessionStoreDir
+	sessionStoreDir = t.TempDir()
+	t.Cleanup(func() { sessionStoreDir = old })
+}
+
+// Returns the active test user from the session store.
+func activeTestUser(t *testing.T) *sessionUser {
+	t.Helper()
+	store, err := loadSessionStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.active() == nil {
+		t.Fatal("no active test user")
+	}
+	return store.active()
+}
+
+// Signs up, logs in and exchanges a bypass login code for a token.
+func loginNewUser(t *testing.T) (string, string) {
+	t.Helper()
+	email := generateRandomEmailAddress()
+	if _, err := signup(email); err != nil {
+		t.Fatalf("signup: %v", err)
+	}
+	userId, err := login(email)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	code, err := getLoginCodeViaBypass(userId)
+	if err != nil {
+		t.Fatalf("getLoginCodeViaBypass: %v", err)
+	}
+	token, _, err := loginCode(userId, code)
+	if err != nil {
+		t.Fatalf("loginCode: %v", err)
+	}
+	return userId, token
+}
+
+func TestSignup(t *testing.T) {
+	f := newFakeApi(t)
+	userId, err := signup("a@email.com")
+	if err != nil {
+		t.Fatalf("signup: %v", err)
+	}
+	if f.emails["a@email.com"] != userId {
+		t.Errorf("fake has userId %q for email, signup returned %q", f.emails["a@email.com"], userId)
+	}
+	if _, err := signup("a@email.com"); err == nil {
+		t.Error("expected error signing up duplicate email")
+	}
+}
+
+func TestLoginUnknownEmail(t *testing.T) {
+	newFakeApi(t)
+	if _, err := login("nobody@email.com"); err == nil {
+		t.Error("expected error logging in unknown email")
+	}
+}
+
+func TestLoginCodeWrongCode(t *testing.T) {
+	newFakeApi(t)
+	email := generateRandomEmailAddress()
+	signup(email)
+	userId, _ := login(email)
+	token, remaining, err := loginCode(userId, 1)
+	if err == nil {
+		t.Fatal("expected error for wrong login code")
+	}
+	if token != "" {
+		t.Errorf("token = %q, want empty", token)
+	}
+	if remaining != 2 {
+		t.Errorf("remainingAttempts = %d, want 2", remaining)
+	}
+}
+
+func TestCreateAndGetExim(t *testing.T) {
+	f := newFakeApi(t)
+	userId, token := loginNewUser(t)
+	eximId := createExim(token)
+	if eximId == "" {
+		t.Fatal("createExim returned empty eximId")
+	}
+	e, ok := f.exims[eximId]
+	if !ok {
+		t.Fatalf("exim %s not stored by fake", eximId)
+	}
+	if e.Author != userId {
+		t.Errorf("author = %q, want %q", e.Author, userId)
+	}
+	if !strings.HasPrefix(e.Link, "https://") {
+		t.Errorf("link = %q, want https:// prefix", e.Link)
+	}
+	getEximDetails(eximId)
+	getEximDetails("missing")
+	getExims()
+}
+
+func TestCreateEximUnauthorized(t *testing.T) {
+	f := newFakeApi(t)
+	if eximId := createExim("bogus"); eximId != "" {
+		t.Errorf("eximId = %q, want empty", eximId)
+	}
+	if len(f.exims) != 0 {
+		t.Errorf("fake stored %d exims, want 0", len(f.exims))
+	}
+}
+
+func TestLogout(t *testing.T) {
+	f := newFakeApi(t)
+	userId, token := loginNewUser(t)
+	if err := logout(token, userId); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if f.users[userId].LogoutTs.IsZero() {
+		t.Error("fake did not record logout")
+	}
+	if err := logout(token, userId); err == nil {
+		t.Error("expected error logging out with revoked token")
+	}
+}
+
+func TestApiFaults(t *testing.T) {
+	f := newFakeApi(t)
+	f.setFault("/api/user/signup/", fakeFault{Status: http.StatusServiceUnavailable, Error: "maintenance"})
+	if _, err := signup("b@email.com"); err == nil || err.Error() != "maintenance" {
+		t.Errorf("signup err = %v, want maintenance", err)
+	}
+
+	f.setFault("/api/user/signup/", fakeFault{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := signup("b@email.com"); err != nil {
+		t.Fatalf("signup with delay: %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("delay fault was not applied")
+	}
+}
+
+func TestWrappedCommands(t *testing.T) {
+	f := newFakeApi(t)
+	resetTestUser(t)
+
+	// Commands requiring earlier state bail out without calling the api.
+	wrappedLogin()
+	wrappedLoginCode()
+	wrappedCreateExim()
+	wrappedGetEximDetails()
+	wrappedLogout()
+	if len(f.users) != 0 {
+		t.Fatalf("fake has %d users before signup, want 0", len(f.users))
+	}
+
+	wrappedSignup()
+	u := activeTestUser(t)
+	if u.UserId == "" || f.emails[u.Email] != u.UserId {
+		t.Fatalf("wrappedSignup did not set test user (email %q, userId %q)", u.Email, u.UserId)
+	}
+	wrappedLogin()
+	wrappedLoginCode()
+	if activeTestUser(t).Token == "" {
+		t.Fatal("wrappedLoginCode did not set test token")
+	}
+	wrappedCreateExim()
+	u = activeTestUser(t)
+	if len(u.Exims) != 1 || f.exims[u.Exims[0]] == nil {
+		t.Fatalf("wrappedCreateExim did not create exim %q", u.Exims)
+	}
+	wrappedGetEximDetails()
+	wrappedLogout()
+	if len(f.tokens) != 0 {
+		t.Errorf("fake has %d live tokens after logout, want 0", len(f.tokens))
+	}
+	if activeTestUser(t).Token != "" {
+		t.Error("wrappedLogout did not clear the test token")
+	}
+}
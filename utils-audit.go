@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Append-only JSONL file recording every mutating action cp-admin performs.
+var auditLogPath = "audit.jsonl"
+
+// Number of most recent matching records shown by the audit log browser.
+const auditPageSize = 20
+
+type auditRecord struct {
+	Ts       time.Time `json:"ts"`
+	Operator string    `json:"operator"`
+	AdminId  string    `json:"adminId"`
+	Profile  string    `json:"profile"`
+	Command  string    `json:"command"`
+	// Arguments the command acted on, e.g. server name or exim id.
+	Args map[string]string `json:"args,omitempty"`
+	// "ok", or "error: <message>".
+	Result string `json:"result"`
+	// Ids of the Hetzner actions started by the command, if any.
+	HetznerActions []int64 `json:"hetznerActions,omitempty"`
+}
+
+// Appends a record of a mutating command, made by the acting admin against
+// the active profile, to the audit log. A failure to write the log is
+// reported but doesn't undo or block the action.
+func auditAction(command string, args map[string]string, result error, hetznerActions ...int64) {
+	record := auditRecord{
+		Ts:             time.Now().UTC(),
+		Operator:       actingAdmin.Name,
+		AdminId:        actingAdmin.AdminId,
+		Profile:        activeProfile,
+		Command:        command,
+		Args:           args,
+		Result:         "ok",
+		HetznerActions: hetznerActions,
+	}
+	if result != nil {
+		record.Result = "error: " + result.Error()
+	}
+
+	line, err := json.Marshal(record)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(auditLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		logErrorf("writing audit log: %v", err)
+	}
+}
+
+// Reads every record in the audit log, oldest first. A missing log is empty.
+func readAuditLog() ([]auditRecord, error) {
+	f, err := os.Open(auditLogPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return records, fmt.Errorf("%s line %d: %v", auditLogPath, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Returns the records matching every space-separated term of filter. A term
+// is "field=value" (fields: operator, profile, command, result, since, until;
+// since/until take a date or RFC3339 time) or plain text matched against the
+// command and arguments. Matching ignores case.
+func filterAuditRecords(records []auditRecord, filter string) ([]auditRecord, error) {
+	matched := records
+	for _, term := range strings.Fields(filter) {
+		field, value, hasField := strings.Cut(term, "=")
+		value = strings.ToLower(value)
+		if !hasField {
+			value = strings.ToLower(term)
+		}
+
+		var bound time.Time
+		if field == "since" || field == "until" {
+			var err error
+			if bound, err = time.Parse(time.RFC3339, strings.ToUpper(value)); err != nil {
+				if bound, err = time.Parse("2006-01-02", value); err != nil {
+					return nil, fmt.Errorf("%s takes a date (2006-01-02) or RFC3339 time", field)
+				}
+				if field == "until" {
+					bound = bound.Add(24 * time.Hour)
+				}
+			}
+		}
+
+		var kept []auditRecord
+		for _, r := range matched {
+			var ok bool
+			switch {
+			case !hasField:
+				ok = strings.Contains(strings.ToLower(r.Command), value)
+				for _, v := range r.Args {
+					ok = ok || strings.Contains(strings.ToLower(v), value)
+				}
+			case field == "operator":
+				ok = strings.ToLower(r.Operator) == value || strings.ToLower(r.AdminId) == value
+			case field == "profile":
+				ok = strings.ToLower(r.Profile) == value
+			case field == "command":
+				ok = strings.Contains(strings.ToLower(r.Command), value)
+			case field == "result":
+				ok = strings.HasPrefix(strings.ToLower(r.Result), value)
+			case field == "since":
+				ok = !r.Ts.Before(bound)
+			case field == "until":
+				ok = r.Ts.Before(bound)
+			default:
+				return nil, fmt.Errorf("unknown filter field %q", field)
+			}
+			if ok {
+				kept = append(kept, r)
+			}
+		}
+		matched = kept
+	}
+	return matched, nil
+}
+
+func formatAuditArgs(args map[string]string) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + args[k]
+	}
+	return strings.Join(parts, " ")
+}
+
+func printAuditRecords(records []auditRecord) {
+	fmt.Printf("\n%-20s %-12s %-10s %-28s %-40s %s\n", "TIME (UTC)", "OPERATOR", "PROFILE", "COMMAND", "ARGS", "RESULT")
+	for _, r := range records {
+		result := r.Result
+		if len(r.HetznerActions) > 0 {
+			ids := make([]string, len(r.HetznerActions))
+			for i, id := range r.HetznerActions {
+				ids[i] = strconv.FormatInt(id, 10)
+			}
+			result += " (hetzner actions " + strings.Join(ids, ",") + ")"
+		}
+		fmt.Printf("%-20s %-12s %-10s %-28s %-40s %s\n", r.Ts.Format("2006-01-02 15:04:05"), truncate(r.Operator, 12), r.Profile,
+			truncate(r.Command, 28), truncate(formatAuditArgs(r.Args), 40), result)
+	}
+}
+
+// Interactive view of the audit log, showing the most recent records that
+// match a filter.
+func browseAuditLog() {
+	records, err := readAuditLog()
+	if err != nil {
+		logErrorf("reading audit log: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		logInfof("audit log %s is empty", auditLogPath)
+		return
+	}
+
+	filter := ""
+	for {
+		matched, err := filterAuditRecords(records, filter)
+		if err != nil {
+			logErrorf("%v", err)
+			matched, filter = records, ""
+		}
+		shown := matched
+		if len(shown) > auditPageSize {
+			shown = shown[len(shown)-auditPageSize:]
+		}
+		printAuditRecords(shown)
+		fmt.Printf("--- showing %d of %d matching records (%d total) ---\n", len(shown), len(matched), len(records))
+
+		input := promptLine("Filter (e.g. operator=jane command=server result=error since=2024-01-31), blank to clear, q to quit: ")
+		if input == "q" {
+			return
+		}
+		filter = input
+	}
+}
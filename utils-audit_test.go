@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Points the audit log at an empty file for the duration of the test.
+func withAuditLog(t *testing.T) {
+	t.Helper()
+	old := auditLogPath
+	auditLogPath = filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Cleanup(func() { auditLogPath = old })
+}
+
+func TestAuditRecordsAdminCalls(t *testing.T) {
+	f := newFakeApi(t)
+	withAuditLog(t)
+	_, token := loginNewUser(t)
+	eximId := createExim(token)
+
+	approveExim(eximId)
+	rejectExim("missing")
+	shutdown()
+
+	records, err := readAuditLog()
+	if err != nil {
+		t.Fatalf("readAuditLog: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3: %+v", len(records), records)
+	}
+	approve := records[0]
+	if approve.Command != "admin POST /api/admin/approve-exim/"+eximId || approve.Result != "ok" ||
+		approve.Operator != "test-admin" || approve.AdminId != testAdminUlid || approve.Profile != activeProfile {
+		t.Errorf("approve record = %+v", approve)
+	}
+	if records[1].Result != "error: exim not found" {
+		t.Errorf("reject result = %q", records[1].Result)
+	}
+	if records[2].Command != "shutdown" || records[2].Args["api"] != apiBaseUrl || f.shutdowns != 1 {
+		t.Errorf("shutdown record = %+v", records[2])
+	}
+}
+
+func TestAuditRecordsQueryArgs(t *testing.T) {
+	newFakeApi(t)
+	withAuditLog(t)
+	userId, _ := loginNewUser(t)
+	deleteUser(userId)
+
+	records, _ := readAuditLog()
+	if len(records) != 1 || records[0].Args["exims"] != "true" || records[0].Command != "admin DELETE /api/admin/user/"+userId {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestFilterAuditRecords(t *testing.T) {
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []auditRecord{
+		{Ts: day, Operator: "jane", Profile: "production", Command: "hetzner delete server", Args: map[string]string{"name": "cp-1"}, Result: "ok", HetznerActions: []int64{42}},
+		{Ts: day.Add(24 * time.Hour), Operator: "admin-one", Profile: "local", Command: "shutdown", Result: "error: 500 Internal Server Error"},
+		{Ts: day.Add(48 * time.Hour), Operator: "jane", Profile: "local", Command: "admin POST /api/admin/approve-exim/01E", Result: "ok"},
+	}
+
+	tests := []struct {
+		filter string
+		want   int
+	}{
+		{"", 3},
+		{"operator=jane", 2},
+		{"operator=JANE profile=local", 1},
+		{"cp-1", 1},
+		{"command=server", 1},
+		{"result=error", 1},
+		{"since=2024-03-02", 2},
+		{"until=2024-03-02", 2},
+		{"since=2024-03-02T00:00:00Z until=2024-03-02", 1},
+	}
+	for _, tt := range tests {
+		got, err := filterAuditRecords(records, tt.filter)
+		if err != nil || len(got) != tt.want {
+			t.Errorf("filter %q: got %d records (err %v), want %d", tt.filter, len(got), err, tt.want)
+		}
+	}
+	for _, bad := range []string{"who=jane", "since=yesterday"} {
+		if _, err := filterAuditRecords(records, bad); err == nil {
+			t.Errorf("filter %q: expected error", bad)
+		}
+	}
+}
+
+func TestAuditLogAppends(t *testing.T) {
+	withAuditLog(t)
+	for i := 0; i < 3; i++ {
+		auditAction("hetzner create server", map[string]string{"name": fmt.Sprintf("cp-%d", i)}, nil, int64(i))
+	}
+	records, err := readAuditLog()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("got %d records (err %v), want 3", len(records), err)
+	}
+	if records[2].Args["name"] != "cp-2" || records[2].HetznerActions[0] != 2 {
+		t.Errorf("last record = %+v", records[2])
+	}
+
+	// The browser runs through filters, including an invalid one, and quits.
+	withInput(t, "name=cp-1", "cp-1", "", "q")
+	browseAuditLog()
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directory (relative to cp-admin) where database backups are kept.
+var backupDir = "backups"
+
+// Returns the user@ip used to reach a remote server as the admin user.
+func sshTarget(serverName string) (string, error) {
+	server, ok := serverMap[serverName]
+	if !ok {
+		return "", fmt.Errorf("server with name %q not found locally... run Get/Set Current Resources command", serverName)
+	}
+	return fmt.Sprintf("%s@%s", os.Getenv("CP_ADMIN_USER_ONE"), server.PublicNet.IPv4.IP.String()), nil
+}
+
+// Builds the ssh command used to reach a remote server as the admin user.
+func sshCommand(serverName string, remoteCmd string) (*exec.Cmd, error) {
+	target, err := sshTarget(serverName)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command("ssh", target, remoteCmd), nil
+}
+
+// Returns a shell command that calls an admin endpoint on the remote server's
+// local API port, so remote admin endpoints needn't be exposed publicly. The
+// auth header is read from stdin, keeping the token out of ps and shell
+// history; run it with sshAdminCommand.
+func remoteAdminCurl(method string, path string) string {
+	return fmt.Sprintf("curl -sf -X %s -H @- http://localhost:8000%s", method, path)
+}
+
+// Builds an ssh command for a remote command containing remoteAdminCurl,
+// feeding it the admin auth header on stdin.
+func sshAdminCommand(serverName string, remoteCmd string) (*exec.Cmd, error) {
+	cmd, err := sshCommand(serverName, remoteCmd)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = strings.NewReader("Admin-Authorization: " + adminAuthToken + "\n")
+	return cmd, nil
+}
+
+// Streams a consistent snapshot of the API server's database to w.
+func fetchBackup(source string, w io.Writer) error {
+	if source != localSource {
+		cmd, err := sshAdminCommand(source, remoteAdminCurl("GET", "/api/admin/backup"))
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	req, err := http.NewRequest("GET", apiBaseUrl+"/api/admin/backup", nil)
+	if err != nil {
+		return err
+	}
+	// Set custom admin auth header.
+	setAdminHeaders(req)
+
+	res, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	logResponse(res)
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("backup endpoint returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// Layout of the timestamp in backup file names; it sorts chronologically.
+const backupTimeLayout = "20060102-150405"
+
+// Returns an error unless source is local or a known server, so that it is
+// safe to use in backup file names and globs.
+func checkBackupSource(source string) error {
+	if source == localSource {
+		return nil
+	}
+	if _, ok := serverMap[source]; !ok {
+		return fmt.Errorf("unknown backup source %q: use %s or a server name (run Get/Set Current Resources to load servers)", source, localSource)
+	}
+	return nil
+}
+
+// Pulls a backup from source into backupDir as cp-api-<source>-<timestamp>.db
+// alongside a sha256sum-style checksum file. Returns the backup's path.
+func backupDatabase(source string) (string, error) {
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("cp-api-%s-%s.db", source, time.Now().UTC().Format(backupTimeLayout))
+	path := filepath.Join(backupDir, name)
+
+	// Write to a partial file first so an interrupted backup is never
+	// mistaken for a complete one.
+	partial := path + ".partial"
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	err = fetchBackup(source, io.MultiWriter(f, hash))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	err = os.WriteFile(path+".sha256", []byte(fmt.Sprintf("%s  %s\n", sum, name)), 0600)
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return path, os.Rename(partial, path)
+}
+
+// Returns the backups taken from source, oldest first. Only names of the form
+// cp-api-<source>-<timestamp>.db match, so a source whose name starts with
+// this one ("cp-1-staging" for "cp-1") is never included.
+func listBackups(source string) ([]string, error) {
+	prefix := fmt.Sprintf("cp-api-%s-", source)
+	paths, err := filepath.Glob(filepath.Join(backupDir, prefix+"*.db"))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, path := range paths {
+		ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".db")
+		if _, err := time.Parse(backupTimeLayout, ts); err == nil {
+			backups = append(backups, path)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Deletes all but the newest keep backups from source, returning how many
+// were removed.
+func pruneBackups(source string, keep int) (int, error) {
+	paths, err := listBackups(source)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i := 0; i < len(paths)-keep; i++ {
+		if err := os.Remove(paths[i]); err != nil {
+			return removed, err
+		}
+		os.Remove(paths[i] + ".sha256")
+		removed++
+	}
+	return removed, nil
+}
+
+// Verifies a backup against its checksum file.
+func verifyBackup(path string) error {
+	data, err := os.ReadFile(path + ".sha256")
+	if err != nil {
+		return fmt.Errorf("reading checksum: %v", err)
+	}
+	want, _, _ := strings.Cut(string(data), " ")
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch: file is %s, expected %s", got, want)
+	}
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	// Call Sync to flush writes to stable storage
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Stops the local API server via the shutdown endpoint, replaces its database
+// file (keeping the old one as .pre-restore) and, if LOCAL_CP_API_DIR is set,
+// starts the server again.
+func restoreLocal(backupPath string) error {
+	dbPath := os.Getenv("LOCAL_CP_API_DB_PATH")
+	if dbPath == "" {
+		return fmt.Errorf("env variable LOCAL_CP_API_DB_PATH is not set")
+	}
+	if dryRunSkip("shut down the local api server, save %s as .pre-restore, copy %s over it and restart", dbPath, backupPath) {
+		return errDryRun
+	}
+
+	// The database is the local one, so stop the local server whatever the
+	// active profile points at.
+	localUrl, _ := profileBaseUrl("local")
+	localAddr := baseUrlAddr(localUrl)
+	localProbe := func() (bool, error) { return portOpen(localAddr), nil }
+	if portOpen(localAddr) {
+		if err := requestShutdown(localUrl, 0); err != nil {
+			return fmt.Errorf("shutting down the local api server: %v", err)
+		}
+		if _, err := waitForPortClosed(localProbe, 10*time.Second); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := copyFile(dbPath, dbPath+".pre-restore"); err != nil {
+			return fmt.Errorf("saving current database: %v", err)
+		}
+	}
+	if err := copyFile(backupPath, dbPath); err != nil {
+		return fmt.Errorf("replacing database: %v", err)
+	}
+	logInfof("database replaced at %s", dbPath)
+
+	apiDir := os.Getenv("LOCAL_CP_API_DIR")
+	if apiDir == "" {
+		logInfof("LOCAL_CP_API_DIR not set; start the api server manually")
+		return nil
+	}
+	runCmd := exec.Command("go", "run", ".")
+	runCmd.Dir = apiDir
+	runCmd.Stdout = os.Stdout
+	runCmd.Stderr = os.Stderr
+	if err := runCmd.Start(); err != nil {
+		return fmt.Errorf("restarting api server: %v", err)
+	}
+	logInfof("restarted api server with PID: %d", runCmd.Process.Pid)
+	return nil
+}
+
+// Copies the backup to the remote server, stops the API via its shutdown
+// endpoint, swaps the database file and starts the systemd service again.
+func restoreRemote(serverName string, backupPath string) error {
+	dbPath := os.Getenv("REMOTE_CP_API_DB_PATH")
+	if dbPath == "" {
+		return fmt.Errorf("env variable REMOTE_CP_API_DB_PATH is not set")
+	}
+	target, err := sshTarget(serverName)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := "/tmp/" + filepath.Base(backupPath)
+	scpCmd := exec.Command("scp", backupPath, fmt.Sprintf("%s:%s", target, tmpPath))
+	scpCmd.Stdout = os.Stdout
+	scpCmd.Stderr = os.Stderr
+
+	// Shut down gracefully first; stopping the unit afterwards keeps systemd
+	// from restarting it before the file is swapped.
+	remoteCmd := remoteAdminCurl("POST", "/api/admin/shutdown/") + " ; " + strings.Join([]string{
+		"sudo systemctl stop cp-api",
+		fmt.Sprintf("sudo cp %s %s.pre-restore", dbPath, dbPath),
+		// Keep the owner and mode cp-api's service user needs to open it.
+		fmt.Sprintf("sudo chown --reference=%s %s", dbPath, tmpPath),
+		fmt.Sprintf("sudo chmod --reference=%s %s", dbPath, tmpPath),
+		fmt.Sprintf("sudo mv %s %s", tmpPath, dbPath),
+		"sudo systemctl start cp-api",
+	}, " && ")
+	cmd, err := sshAdminCommand(serverName, remoteCmd)
+	if err != nil {
+		return err
+	}
+	if dryRunSkip("run: %s\n          then: %s", strings.Join(scpCmd.Args, " "), strings.Join(cmd.Args, " ")) {
+		return errDryRun
+	}
+
+	if err := scpCmd.Run(); err != nil {
+		return fmt.Errorf("copying backup to %s: %v", serverName, err)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Prompts for a source, pulls a backup and prunes old ones.
+func runBackupDatabase() {
+	source := promptWithDefault("Backup source (local or server name, e.g. cp-1)", localSource)
+	if err := checkBackupSource(source); err != nil {
+		logErrorf("%v", err)
+		return
+	}
+	keep, err := strconv.Atoi(promptWithDefault("Backups to retain for this source", "10"))
+	if err != nil || keep < 1 {
+		logErrorf("retention must be a positive integer")
+		return
+	}
+
+	path, err := backupDatabase(source)
+	if err != nil {
+		logErrorf("backing up database: %v", err)
+		return
+	}
+	logInfof("backup written to %s", path)
+
+	removed, err := pruneBackups(source, keep)
+	if err != nil {
+		logErrorf("pruning old backups: %v", err)
+		return
+	}
+	if removed > 0 {
+		logInfof("pruned %d old backups", removed)
+	}
+}
+
+// Prompts for a backup to restore and a target, verifies the backup's
+// checksum and replaces the target's database with it.
+func runRestoreDatabase() {
+	source := promptWithDefault("Restore backups taken from (local or server name)", localSource)
+	if err := checkBackupSource(source); err != nil {
+		logErrorf("%v", err)
+		return
+	}
+	paths, err := listBackups(source)
+	if err != nil || len(paths) == 0 {
+		logErrorf("no backups found for %s", source)
+		return
+	}
+	for i, path := range paths {
+		fmt.Printf("[%d] %s\n", i+1, filepath.Base(path))
+	}
+	choice, err := strconv.Atoi(promptWithDefault("Backup #", strconv.Itoa(len(paths))))
+	if err != nil || choice < 1 || choice > len(paths) {
+		logErrorf("invalid backup selection")
+		return
+	}
+	path := paths[choice-1]
+
+	if err := verifyBackup(path); err != nil {
+		logErrorf("verifying backup: %v", err)
+		return
+	}
+
+	target := promptWithDefault("Restore to (local or server name)", source)
+	if !confirmDestructive(fmt.Sprintf("stop the api server on %s and replace its database", target), target) {
+		return
+	}
+
+	if target == localSource {
+		err = restoreLocal(path)
+	} else {
+		err = restoreRemote(target, path)
+	}
+	if err == errDryRun {
+		return
+	}
+	auditAction("restore database", map[string]string{"backup": filepath.Base(path), "target": target}, err)
+	if err != nil {
+		logErrorf("restoring database: %v", err)
+		return
+	}
+	logInfof("restored %s to %s", filepath.Base(path), target)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Points backupDir at a fresh temp directory for the test.
+func withBackupDir(t *testing.T) string {
+	t.Helper()
+	old := backupDir
+	backupDir = t.TempDir()
+	t.Cleanup(func() { backupDir = old })
+	return backupDir
+}
+
+// Replaces the known servers with a single unreachable "cp-1".
+func withTestServer(t *testing.T) {
+	t.Helper()
+	old := serverMap
+	t.Cleanup(func() { serverMap = old })
+	serverMap = map[string]*hcloud.Server{
+		"cp-1": {Name: "cp-1", PublicNet: hcloud.ServerPublicNet{IPv4: hcloud.ServerPublicNetIPv4{IP: net.ParseIP("192.0.2.1")}}},
+	}
+}
+
+func TestBackupDatabase(t *testing.T) {
+	newFakeApi(t)
+	dir := withBackupDir(t)
+	signup("a@email.com")
+
+	path, err := backupDatabase(localSource)
+	if err != nil {
+		t.Fatalf("backupDatabase: %v", err)
+	}
+	if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "cp-api-local-") {
+		t.Errorf("backup path = %s", path)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "USER_EMAIL") {
+		t.Errorf("backup does not contain database contents: %s", data)
+	}
+	if err := verifyBackup(path); err != nil {
+		t.Errorf("verifyBackup: %v", err)
+	}
+
+	// Corrupt the backup and check verification fails.
+	os.WriteFile(path, []byte("corrupt"), 0600)
+	if err := verifyBackup(path); err == nil {
+		t.Error("expected checksum mismatch for corrupted backup")
+	}
+}
+
+func TestBackupDatabaseFailure(t *testing.T) {
+	f := newFakeApi(t)
+	dir := withBackupDir(t)
+	f.setFault("/api/admin/", fakeFault{Status: 500, Error: "disk on fire"})
+	if _, err := backupDatabase(localSource); err == nil {
+		t.Fatal("expected error from failing backup endpoint")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("failed backup left %d files behind", len(files))
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := withBackupDir(t)
+	for _, ts := range []string{"20260101-000000", "20260102-000000", "20260103-000000", "20260104-000000"} {
+		name := filepath.Join(dir, "cp-api-local-"+ts+".db")
+		os.WriteFile(name, nil, 0600)
+		os.WriteFile(name+".sha256", nil, 0600)
+	}
+	os.WriteFile(filepath.Join(dir, "cp-api-cp-1-20250101-000000.db"), nil, 0600)
+	os.WriteFile(filepath.Join(dir, "cp-api-cp-1-staging-20250101-000000.db"), nil, 0600)
+
+	removed, err := pruneBackups(localSource, 2)
+	if err != nil || removed != 2 {
+		t.Fatalf("pruneBackups removed %d (err %v), want 2", removed, err)
+	}
+	left, _ := listBackups(localSource)
+	if len(left) != 2 || !strings.Contains(left[0], "20260103") || !strings.Contains(left[1], "20260104") {
+		t.Errorf("remaining backups = %v", left)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cp-api-local-20260101-000000.db.sha256")); !os.IsNotExist(err) {
+		t.Error("checksum of pruned backup was not removed")
+	}
+	if other, _ := listBackups("cp-1"); len(other) != 1 {
+		t.Error("pruning local backups touched another source")
+	}
+
+	// A source whose name starts with another's keeps its own backups.
+	if removed, err := pruneBackups("cp", 0); err != nil || removed != 0 {
+		t.Errorf("pruning cp removed %d (err %v), want 0", removed, err)
+	}
+	if _, err := pruneBackups("cp-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if staging, _ := listBackups("cp-1-staging"); len(staging) != 1 {
+		t.Error("pruning cp-1 removed cp-1-staging's backup")
+	}
+}
+
+func TestCheckBackupSource(t *testing.T) {
+	withTestServer(t)
+	for _, source := range []string{localSource, "cp-1"} {
+		if err := checkBackupSource(source); err != nil {
+			t.Errorf("%s: %v", source, err)
+		}
+	}
+	for _, source := range []string{"cp-2", "*", "../cp-1", ""} {
+		if checkBackupSource(source) == nil {
+			t.Errorf("accepted source %q", source)
+		}
+	}
+}
+
+func TestRestoreLocal(t *testing.T) {
+	// The active profile points elsewhere; only the local server may be stopped.
+	f := newFakeApi(t)
+	f.closeOnShutdown = true
+	t.Setenv("LOCAL_API_BASE_URL", f.server.URL)
+	active := newFakeApi(t)
+	dir := withBackupDir(t)
+	backup := filepath.Join(dir, "cp-api-local-20260101-000000.db")
+	os.WriteFile(backup, []byte("restored"), 0600)
+	dbPath := filepath.Join(t.TempDir(), "cp.db")
+	os.WriteFile(dbPath, []byte("current"), 0600)
+	t.Setenv("LOCAL_CP_API_DB_PATH", dbPath)
+	t.Setenv("LOCAL_CP_API_DIR", "")
+
+	start := time.Now()
+	if err := restoreLocal(backup); err != nil {
+		t.Fatalf("restoreLocal: %v", err)
+	}
+	if f.shutdowns != 1 || active.shutdowns != 0 {
+		t.Errorf("shutdowns = %d local, %d active, want 1 and 0", f.shutdowns, active.shutdowns)
+	}
+	if data, _ := os.ReadFile(dbPath); string(data) != "restored" {
+		t.Errorf("database = %q, want restored contents", data)
+	}
+	if data, _ := os.ReadFile(dbPath + ".pre-restore"); string(data) != "current" {
+		t.Errorf("pre-restore copy = %q, want previous contents", data)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("restore waited too long for the server to stop")
+	}
+}
+
+func TestRunRestoreDatabaseDeclined(t *testing.T) {
+	f := newFakeApi(t)
+	withBackupDir(t)
+	signup("a@email.com")
+	path, _ := backupDatabase(localSource)
+	dbPath := filepath.Join(t.TempDir(), "cp.db")
+	t.Setenv("LOCAL_CP_API_DB_PATH", dbPath)
+
+	withInput(t, "local", "1", "local", "n")
+	runRestoreDatabase()
+	if f.shutdowns != 0 {
+		t.Errorf("declined restore shut down the server")
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Errorf("declined restore wrote %s from %s", dbPath, path)
+	}
+}
+
+func TestRestoreRemoteKeepsOwnerAndMode(t *testing.T) {
+	withTestServer(t)
+	t.Setenv("REMOTE_CP_API_DB_PATH", "/var/lib/cp/cp.db")
+	withGuards(t, "local", true)
+
+	out := captureOutput(t, func() {
+		if err := restoreRemote("cp-1", "backups/local-1.db"); err != errDryRun {
+			t.Fatalf("restoreRemote = %v, want errDryRun", err)
+		}
+	})
+	want := "sudo chown --reference=/var/lib/cp/cp.db /tmp/local-1.db && sudo chmod --reference=/var/lib/cp/cp.db /tmp/local-1.db && sudo mv /tmp/local-1.db /var/lib/cp/cp.db"
+	if !strings.Contains(out, want) {
+		t.Errorf("restore command missing %q:\n%s", want, out)
+	}
+}
+
+func TestSshAdminCommandKeepsTokenOffCommandLine(t *testing.T) {
+	withTestServer(t)
+
+	cmd, err := sshAdminCommand("cp-1", remoteAdminCurl("GET", "/api/admin/backup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := strings.Join(cmd.Args, " "); strings.Contains(args, adminAuthToken) || !strings.Contains(args, "-H @-") {
+		t.Errorf("args = %q", args)
+	}
+	stdin, _ := io.ReadAll(cmd.Stdin)
+	if string(stdin) != "Admin-Authorization: "+adminAuthToken+"\n" {
+		t.Errorf("stdin = %q", stdin)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Number of rows shown per page of the bucket viewer.
+const bucketPageSize = 20
+
+// A raw key/value pair as returned by the api server (base64 in JSON).
+type bucketEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// A bucket entry decoded for display and export.
+type bucketRow struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Size  int    `json:"size"`
+}
+
+// Crockford's base32 alphabet, as used by ULIDs.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Encodes 16 raw bytes as a 26 character ULID string.
+func encodeUlid(b []byte) string {
+	out := make([]byte, 26)
+	// 26 characters of 5 bits hold 130 bits; the 128 bits of b are
+	// right-aligned, so the first character only carries 3 bits.
+	for i := 0; i < 26; i++ {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			v <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockfordAlphabet[v]
+	}
+	return string(out)
+}
+
+// Decodes a 26 character ULID string into its 16 raw bytes.
+func decodeUlid(s string) ([]byte, error) {
+	s = strings.ToUpper(s)
+	if len(s) != 26 || s[0] > '7' {
+		return nil, fmt.Errorf("invalid ulid %q", s)
+	}
+	b := make([]byte, 16)
+	for i := 0; i < 26; i++ {
+		v := strings.IndexByte(crockfordAlphabet, s[i])
+		if v < 0 {
+			return nil, fmt.Errorf("invalid ulid character %q", s[i])
+		}
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			if bit >= 0 && v&(0x10>>j) != 0 {
+				b[bit/8] |= 0x80 >> (bit % 8)
+			}
+		}
+	}
+	return b, nil
+}
+
+func isPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Renders raw bucket bytes as compact JSON, a ULID (16 bytes), printable text,
+// or hex, in that order of preference.
+func decodeBucketBytes(b []byte) string {
+	if json.Valid(b) && (bytes.HasPrefix(b, []byte("{")) || bytes.HasPrefix(b, []byte("["))) {
+		var buf bytes.Buffer
+		if json.Compact(&buf, b) == nil {
+			return buf.String()
+		}
+	}
+	if len(b) == 16 && !isPrintable(string(b)) {
+		return encodeUlid(b)
+	}
+	if isPrintable(string(b)) {
+		return string(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func decodeBucketEntries(entries []bucketEntry) []bucketRow {
+	rows := make([]bucketRow, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, bucketRow{
+			Key:   decodeBucketBytes(e.Key),
+			Value: decodeBucketBytes(e.Value),
+			Size:  len(e.Key) + len(e.Value),
+		})
+	}
+	return rows
+}
+
+// Bounds for a bucket scan (Start and End are inclusive). Empty fields are
+// unbounded; a zero limit lets the server decide.
+type bucketScan struct {
+	Prefix []byte
+	Start  []byte
+	End    []byte
+	Limit  int
+}
+
+// Summary of a bucket as reported by the api server.
+type bucketInfo struct {
+	Name     string `json:"name"`
+	KeyCount int    `json:"keyCount"`
+}
+
+// Get the names and key counts of every bucket on the API server.
+func getBuckets() ([]bucketInfo, error) {
+	var resBody bucketsResponse
+	err := adminGet(apiBaseUrl+"/api/admin/buckets", &resBody, &resBody.Error)
+	return resBody.Buckets, err
+}
+
+// Get the key/value pairs in a bucket on the API server within scan's bounds.
+// Keys in the query string are base64url encoded since they may be binary.
+func scanBucket(bucket string, scan bucketScan) ([]bucketEntry, error) {
+	var resBody bucketScanResponse
+	query := neturl.Values{}
+	for name, b := range map[string][]byte{"prefix": scan.Prefix, "start": scan.Start, "end": scan.End} {
+		if len(b) > 0 {
+			query.Set(name, base64.URLEncoding.EncodeToString(b))
+		}
+	}
+	if scan.Limit > 0 {
+		query.Set("limit", strconv.Itoa(scan.Limit))
+	}
+	url := fmt.Sprintf("%s/api/admin/bucket/%s", apiBaseUrl, neturl.PathEscape(bucket))
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+	err := adminGet(url, &resBody, &resBody.Error)
+	return resBody.Entries, err
+}
+
+// Number of entries requested per page when reading a whole bucket.
+var bucketScanPageSize = 1000
+
+// Get every key/value pair in a bucket on the API server. The bucket is read
+// in pages, each starting just after the last key seen, until a page comes
+// back empty; a short page isn't taken as the end, since the server may cap
+// how many entries it returns.
+func getBucket(bucket string) ([]bucketEntry, error) {
+	var all []bucketEntry
+	scan := bucketScan{Limit: bucketScanPageSize}
+	for {
+		entries, err := scanBucket(bucket, scan)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return all, nil
+		}
+		if len(all) > 0 && bytes.Compare(entries[0].Key, all[len(all)-1].Key) <= 0 {
+			return nil, fmt.Errorf("scanning bucket %s: server ignored the start key", bucket)
+		}
+		all = append(all, entries...)
+		// The smallest key after the last one seen.
+		scan.Start = append(append([]byte{}, entries[len(entries)-1].Key...), 0)
+	}
+}
+
+// Get a single key from a bucket on the API server.
+func getBucketKey(bucket string, key []byte) (bucketEntry, error) {
+	var resBody bucketEntryResponse
+	url := fmt.Sprintf("%s/api/admin/bucket/%s/key?key=%s", apiBaseUrl, neturl.PathEscape(bucket), base64.URLEncoding.EncodeToString(key))
+	err := adminGet(url, &resBody, &resBody.Error)
+	return resBody.Entry, err
+}
+
+// Parses a key typed by the user: "u:<ULID>" for a 16 byte ULID, "x:<hex>"
+// for raw bytes, or anything else as literal text.
+func parseKeyInput(input string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(input, "u:"):
+		return decodeUlid(strings.TrimPrefix(input, "u:"))
+	case strings.HasPrefix(input, "x:"):
+		return hex.DecodeString(strings.TrimPrefix(input, "x:"))
+	default:
+		return []byte(input), nil
+	}
+}
+
+// Returns rows whose key or value contains query, ignoring case.
+func searchBucketRows(rows []bucketRow, query string) []bucketRow {
+	query = strings.ToLower(query)
+	var matched []bucketRow
+	for _, r := range rows {
+		if strings.Contains(strings.ToLower(r.Key), query) || strings.Contains(strings.ToLower(r.Value), query) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Writes rows to path as JSON or CSV.
+func exportBucketRows(rows []bucketRow, format string, path string) error {
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unknown export format %q (want json or csv)", format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "csv":
+		w := csv.NewWriter(f)
+		w.Write([]string{"key", "value", "size"})
+		for _, r := range rows {
+			w.Write([]string{r.Key, r.Value, strconv.Itoa(r.Size)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return nil
+}
+
+func printBucketPage(bucket string, rows []bucketRow, page int, query string) {
+	pages := (len(rows) + bucketPageSize - 1) / bucketPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	search := ""
+	if query != "" {
+		search = fmt.Sprintf(", search %q", query)
+	}
+	fmt.Printf("\n--- %s: %d entries%s, page %d/%d ---\n", bucket, len(rows), search, page+1, pages)
+	fmt.Printf("%-4s %-36s %6s  %s\n", "#", "KEY", "SIZE", "VALUE")
+	for i := page * bucketPageSize; i < len(rows) && i < (page+1)*bucketPageSize; i++ {
+		r := rows[i]
+		fmt.Printf("%-4d %-36s %6d  %s\n", i+1, truncate(r.Key, 36), r.Size, truncate(r.Value, 80))
+	}
+	fmt.Println("-------------------------------------")
+}
+
+// Interactive, paginated and searchable table of decoded bucket rows.
+func browseBucketRows(bucket string, all []bucketRow) {
+	rows := all
+	query := ""
+	page := 0
+	for {
+		pages := (len(rows) + bucketPageSize - 1) / bucketPageSize
+		if page >= pages && pages > 0 {
+			page = pages - 1
+		}
+		printBucketPage(bucket, rows, page, query)
+		input := promptLine("n/p page, s <text> search, c clear, v # view, e json|csv <file> export, q quit: ")
+		cmd, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch cmd {
+		case "n":
+			if page < pages-1 {
+				page++
+			}
+		case "p":
+			if page > 0 {
+				page--
+			}
+		case "s":
+			query = arg
+			rows = searchBucketRows(all, query)
+			page = 0
+		case "c":
+			query = ""
+			rows = all
+			page = 0
+		case "v":
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < 1 || i > len(rows) {
+				logErrorf("no row numbered %q", arg)
+				continue
+			}
+			fmt.Printf("\nkey: %s\nsize: %d bytes\nvalue: %s\n", rows[i-1].Key, rows[i-1].Size, rows[i-1].Value)
+		case "e":
+			format, path, _ := strings.Cut(arg, " ")
+			path = strings.TrimSpace(path)
+			if path == "" {
+				path = fmt.Sprintf("%s.%s", strings.ToLower(bucket), format)
+			}
+			err := exportBucketRows(rows, format, path)
+			if err != nil {
+				logErrorf("exporting bucket: %v", err)
+				continue
+			}
+			logInfof("exported %d rows to %s", len(rows), path)
+		case "q":
+			return
+		}
+	}
+}
+
+func printBucketSummary(buckets []bucketInfo) {
+	total := 0
+	fmt.Printf("\n%-4s %-24s %10s\n", "#", "BUCKET", "KEYS")
+	for i, b := range buckets {
+		fmt.Printf("%-4d %-24s %10d\n", i+1, b.Name, b.KeyCount)
+		total += b.KeyCount
+	}
+	fmt.Printf("%-4s %-24s %10d\n", "", "TOTAL", total)
+}
+
+// Prompts for scans of a single bucket, opening each result in the viewer.
+func browseBucket(bucket string) {
+	for {
+		input := promptLine(fmt.Sprintf("%s: a all, p <prefix> prefix, r <start> <end> range, g <key> get, q back (keys: text, u:<ULID>, x:<hex>): ", bucket))
+		cmd, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+
+		var scan bucketScan
+		var err error
+		switch cmd {
+		case "a":
+		case "p":
+			scan.Prefix, err = parseKeyInput(arg)
+		case "r":
+			start, end, _ := strings.Cut(arg, " ")
+			scan.Start, err = parseKeyInput(start)
+			if err == nil {
+				scan.End, err = parseKeyInput(strings.TrimSpace(end))
+			}
+		case "g":
+			var key []byte
+			key, err = parseKeyInput(arg)
+			if err != nil {
+				break
+			}
+			entry, err := getBucketKey(bucket, key)
+			if err != nil {
+				continue
+			}
+			row := decodeBucketEntries([]bucketEntry{entry})[0]
+			fmt.Printf("\nkey: %s\nsize: %d bytes\nvalue: %s\n", row.Key, row.Size, row.Value)
+			continue
+		case "q":
+			return
+		default:
+			continue
+		}
+		if err != nil {
+			logErrorf("parsing key: %v", err)
+			continue
+		}
+
+		entries, err := scanBucket(bucket, scan)
+		if err != nil {
+			continue
+		}
+		browseBucketRows(bucket, decodeBucketEntries(entries))
+	}
+}
+
+// Lists the buckets on the API server with their key counts and lets the
+// admin pick one to browse.
+func browseBuckets() {
+	for {
+		buckets, err := getBuckets()
+		if err != nil {
+			return
+		}
+		printBucketSummary(buckets)
+		input := promptLine("Bucket # or name (q to quit): ")
+		if input == "q" || input == "" {
+			return
+		}
+		name := ""
+		if i, err := strconv.Atoi(input); err == nil && i >= 1 && i <= len(buckets) {
+			name = buckets[i-1].Name
+		}
+		for _, b := range buckets {
+			if strings.EqualFold(b.Name, input) {
+				name = b.Name
+			}
+		}
+		if name == "" {
+			logErrorf("no bucket %q", input)
+			continue
+		}
+		browseBucket(name)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncodeUlid(t *testing.T) {
+	cases := map[string]string{
+		"00000000000000000000000000000000": "00000000000000000000000000",
+		"00000000000000000000000000000001": "00000000000000000000000001",
+		"ffffffffffffffffffffffffffffffff": "7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+		"01563e3ab5d3d6764c61efb99302bd5b": "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+	}
+	for hexIn, want := range cases {
+		b, _ := hex.DecodeString(hexIn)
+		if got := encodeUlid(b); got != want {
+			t.Errorf("encodeUlid(%s) = %s, want %s", hexIn, got, want)
+		}
+	}
+}
+
+func TestDecodeBucketBytes(t *testing.T) {
+	ulidBytes := []byte{0x01, 0x56, 0x3e, 0x3a, 0xb5, 0xd3, 0xd6, 0x76, 0x4c, 0x61, 0xef, 0xb9, 0x93, 0x02, 0xbd, 0x5b}
+	cases := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte(`{ "a": 1,  "b": [1, 2] }`), `{"a":1,"b":[1,2]}`},
+		{ulidBytes, "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{[]byte("person@email.com"), "person@email.com"},
+		{[]byte{0x00, 0xff, 0x10}, "0x00ff10"},
+		{[]byte("42"), "42"},
+	}
+	for _, c := range cases {
+		if got := decodeBucketBytes(c.in); got != c.want {
+			t.Errorf("decodeBucketBytes(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSearchBucketRows(t *testing.T) {
+	rows := []bucketRow{{Key: "a@email.com", Value: "01X"}, {Key: "b@email.com", Value: "01Y"}, {Key: "01Z", Value: `{"email":"A@EMAIL.COM"}`}}
+	got := searchBucketRows(rows, "a@email")
+	if len(got) != 2 || got[0].Key != "a@email.com" || got[1].Key != "01Z" {
+		t.Errorf("search matched %+v", got)
+	}
+}
+
+func TestExportBucketRows(t *testing.T) {
+	rows := []bucketRow{{Key: "k1", Value: `{"a":"x,y"}`, Size: 12}, {Key: "k2", Value: "v", Size: 3}}
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "rows.json")
+	if err := exportBucketRows(rows, "json", jsonPath); err != nil {
+		t.Fatalf("json export: %v", err)
+	}
+	var got []bucketRow
+	data, _ := os.ReadFile(jsonPath)
+	if err := json.Unmarshal(data, &got); err != nil || len(got) != 2 || got[0] != rows[0] {
+		t.Errorf("json export round trip = %+v (err %v)", got, err)
+	}
+
+	csvPath := filepath.Join(dir, "rows.csv")
+	if err := exportBucketRows(rows, "csv", csvPath); err != nil {
+		t.Fatalf("csv export: %v", err)
+	}
+	data, _ = os.ReadFile(csvPath)
+	want := "key,value,size\nk1,\"{\"\"a\"\":\"\"x,y\"\"}\",12\nk2,v,3\n"
+	if string(data) != want {
+		t.Errorf("csv export = %q, want %q", data, want)
+	}
+
+	if err := exportBucketRows(rows, "xml", filepath.Join(dir, "rows.xml")); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rows.xml")); !os.IsNotExist(err) {
+		t.Error("unknown format should not create a file")
+	}
+}
+
+func TestGetBucket(t *testing.T) {
+	newFakeApi(t)
+	_, token := loginNewUser(t)
+	createExim(token)
+
+	for _, name := range []string{"USER_EMAIL", "USER_AUTH", "ADMIN_EMAIL", "MOD_EXIM"} {
+		entries, err := getBucket(name)
+		if err != nil || len(entries) != 1 {
+			t.Errorf("%s: %d entries (err %v), want 1", name, len(entries), err)
+		}
+	}
+	if _, err := getBucket("NOPE"); err == nil {
+		t.Error("expected error for unknown bucket")
+	}
+
+	entries, _ := getBucket("MOD_EXIM")
+	rows := decodeBucketEntries(entries)
+	if !strings.HasPrefix(rows[0].Value, `{"eximId":`) || rows[0].Size != len(entries[0].Key)+len(entries[0].Value) {
+		t.Errorf("decoded MOD_EXIM row = %+v", rows[0])
+	}
+}
+
+func TestGetBucketPages(t *testing.T) {
+	f := newFakeApi(t)
+	for i := 0; i < 5; i++ {
+		signup(generateRandomEmailAddress())
+	}
+	old := bucketScanPageSize
+	t.Cleanup(func() { bucketScanPageSize = old })
+	bucketScanPageSize = 2
+	// The server returns fewer entries than asked for, as a truncating
+	// server would.
+	f.scanCap = 1
+
+	entries, err := getBucket("USER_EMAIL")
+	if err != nil || len(entries) != 5 {
+		t.Fatalf("got %d entries (err %v), want 5", len(entries), err)
+	}
+	for i := 1; i < len(entries); i++ {
+		if string(entries[i-1].Key) >= string(entries[i].Key) {
+			t.Errorf("entries out of order or repeated at %d", i)
+		}
+	}
+}
+
+func TestDecodeUlid(t *testing.T) {
+	for _, ulid := range []string{"00000000000000000000000000", "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", "01ARZ3NDEKTSV4RRFFQ69G5FAV"} {
+		b, err := decodeUlid(ulid)
+		if err != nil {
+			t.Fatalf("decodeUlid(%s): %v", ulid, err)
+		}
+		if got := encodeUlid(b); got != ulid {
+			t.Errorf("round trip of %s = %s", ulid, got)
+		}
+	}
+	for _, bad := range []string{"short", "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", "0000000000000000000000000U"} {
+		if _, err := decodeUlid(bad); err == nil {
+			t.Errorf("decodeUlid(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseKeyInput(t *testing.T) {
+	cases := map[string][]byte{
+		"a@email.com":                  []byte("a@email.com"),
+		"x:00ff":                       {0x00, 0xff},
+		"u:00000000000000000000000001": append(make([]byte, 15), 1),
+	}
+	for in, want := range cases {
+		got, err := parseKeyInput(in)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("parseKeyInput(%q) = %x (err %v), want %x", in, got, err, want)
+		}
+	}
+	if _, err := parseKeyInput("x:zz"); err == nil {
+		t.Error("expected error for invalid hex")
+	}
+}
+
+func TestScanBucket(t *testing.T) {
+	newFakeApi(t)
+	for _, email := range []string{"ann@email.com", "bob@email.com", "bea@email.com", "cal@email.com"} {
+		signup(email)
+	}
+
+	buckets, err := getBuckets()
+	if err != nil || len(buckets) != 4 {
+		t.Fatalf("getBuckets = %+v (err %v)", buckets, err)
+	}
+	for _, b := range buckets {
+		if b.Name == "USER_EMAIL" && b.KeyCount != 4 {
+			t.Errorf("USER_EMAIL keyCount = %d, want 4", b.KeyCount)
+		}
+	}
+
+	keys := func(entries []bucketEntry) string {
+		var ks []string
+		for _, e := range entries {
+			ks = append(ks, string(e.Key))
+		}
+		return strings.Join(ks, ",")
+	}
+	cases := []struct {
+		scan bucketScan
+		want string
+	}{
+		{bucketScan{Prefix: []byte("b")}, "bea@email.com,bob@email.com"},
+		{bucketScan{Start: []byte("b"), End: []byte("c")}, "bea@email.com,bob@email.com"},
+		{bucketScan{Limit: 3}, "ann@email.com,bea@email.com,bob@email.com"},
+	}
+	for _, c := range cases {
+		entries, err := scanBucket("USER_EMAIL", c.scan)
+		if err != nil || keys(entries) != c.want {
+			t.Errorf("scan %+v = %s (err %v), want %s", c.scan, keys(entries), err, c.want)
+		}
+	}
+
+	entry, err := getBucketKey("USER_EMAIL", []byte("cal@email.com"))
+	if err != nil || string(entry.Key) != "cal@email.com" {
+		t.Errorf("getBucketKey = %+v (err %v)", entry, err)
+	}
+	if _, err := getBucketKey("USER_EMAIL", []byte("nobody")); err == nil {
+		t.Error("expected error for missing key")
+	}
+}
+
+func TestBrowseBuckets(t *testing.T) {
+	newFakeApi(t)
+	for i := 0; i < 3; i++ {
+		signup(generateRandomEmailAddress())
+	}
+	path := filepath.Join(t.TempDir(), "emails.csv")
+	withInput(t,
+		"nope", "USER_EMAIL",
+		"g missing@email.com", "g x:zz",
+		"a", "n", "p", "s @email.com", "v 1", "v 9", "c", "e csv "+path, "q",
+		"q", "q")
+	browseBuckets()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 4 {
+		t.Errorf("export has %d lines, want header + 3 rows", lines)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// Failed login-code attempts after which cp-api locks a user out.
+const maxLoginAttempts = 3
+
+// Kinds of problem reported by the consistency checker.
+const (
+	issueOrphanedAuth   = "orphaned auth record"
+	issueMissingAuth    = "email without auth record"
+	issueOrphanedExim   = "exim with missing author"
+	issueDuplicateEmail = "duplicate email (case)"
+	issueStaleLogin     = "stale login state"
+)
+
+type consistencyIssue struct {
+	Kind   string
+	Bucket string
+	Key    []byte
+	Detail string
+	// Whether repair mode can fix the issue by deleting Key from Bucket.
+	Repairable bool
+}
+
+// Auth fields the checker cares about; other fields are ignored.
+type authRecord struct {
+	Email         string `json:"email"`
+	LoginCode     int    `json:"loginCode"`
+	LoginAttempts int    `json:"loginAttempts"`
+}
+
+// Cross-checks USER_EMAIL, USER_AUTH and MOD_EXIM. Keys and ids are compared
+// in their decoded (display) form so binary ULIDs and text ids both work.
+func checkConsistency(buckets map[string][]bucketEntry) []consistencyIssue {
+	var issues []consistencyIssue
+
+	// userId -> email, from USER_EMAIL.
+	emailUsers := make(map[string]string)
+	// lowercased email -> emails, to spot case-only duplicates.
+	folded := make(map[string][]string)
+	for _, e := range buckets["USER_EMAIL"] {
+		email := decodeBucketBytes(e.Key)
+		emailUsers[decodeBucketBytes(e.Value)] = email
+		folded[strings.ToLower(email)] = append(folded[strings.ToLower(email)], email)
+	}
+
+	authUsers := make(map[string]bool)
+	for _, e := range buckets["USER_AUTH"] {
+		userId := decodeBucketBytes(e.Key)
+		authUsers[userId] = true
+		if _, ok := emailUsers[userId]; !ok {
+			issues = append(issues, consistencyIssue{
+				Kind:       issueOrphanedAuth,
+				Bucket:     "USER_AUTH",
+				Key:        e.Key,
+				Detail:     fmt.Sprintf("userId %s has no USER_EMAIL entry", userId),
+				Repairable: true,
+			})
+		}
+		var auth authRecord
+		if json.Unmarshal(e.Value, &auth) == nil && auth.LoginCode != 0 && auth.LoginAttempts >= maxLoginAttempts {
+			issues = append(issues, consistencyIssue{
+				Kind:   issueStaleLogin,
+				Bucket: "USER_AUTH",
+				Key:    e.Key,
+				Detail: fmt.Sprintf("userId %s has a pending login code after %d failed attempts", userId, auth.LoginAttempts),
+			})
+		}
+	}
+
+	for _, e := range buckets["USER_EMAIL"] {
+		userId := decodeBucketBytes(e.Value)
+		if !authUsers[userId] {
+			issues = append(issues, consistencyIssue{
+				Kind:       issueMissingAuth,
+				Bucket:     "USER_EMAIL",
+				Key:        e.Key,
+				Detail:     fmt.Sprintf("%s -> userId %s has no USER_AUTH entry", decodeBucketBytes(e.Key), userId),
+				Repairable: true,
+			})
+		}
+	}
+
+	for _, e := range buckets["MOD_EXIM"] {
+		var exim struct {
+			Author string `json:"author"`
+		}
+		if err := json.Unmarshal(e.Value, &exim); err != nil {
+			continue
+		}
+		_, hasEmail := emailUsers[exim.Author]
+		if !hasEmail && !authUsers[exim.Author] {
+			issues = append(issues, consistencyIssue{
+				Kind:       issueOrphanedExim,
+				Bucket:     "MOD_EXIM",
+				Key:        e.Key,
+				Detail:     fmt.Sprintf("exim %s author %s does not exist", decodeBucketBytes(e.Key), exim.Author),
+				Repairable: true,
+			})
+		}
+	}
+
+	for _, emails := range folded {
+		if len(emails) > 1 {
+			sort.Strings(emails)
+			issues = append(issues, consistencyIssue{
+				Kind:   issueDuplicateEmail,
+				Bucket: "USER_EMAIL",
+				Key:    []byte(emails[0]),
+				Detail: strings.Join(emails, ", "),
+			})
+		}
+	}
+
+	// Report in a stable order.
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return string(issues[i].Key) < string(issues[j].Key)
+	})
+	return issues
+}
+
+// Delete a single key from a bucket on the API server.
+func deleteBucketKey(bucket string, key []byte) error {
+	return adminDo("DELETE", fmt.Sprintf("%s/api/admin/bucket/%s/key?key=%s", apiBaseUrl, neturl.PathEscape(bucket), base64.URLEncoding.EncodeToString(key)))
+}
+
+// Loads the buckets the checker needs from the API server.
+func loadConsistencyBuckets() (map[string][]bucketEntry, error) {
+	buckets := make(map[string][]bucketEntry)
+	for _, name := range []string{"USER_EMAIL", "USER_AUTH", "MOD_EXIM"} {
+		entries, err := getBucket(name)
+		if err != nil {
+			return nil, err
+		}
+		buckets[name] = entries
+	}
+	return buckets, nil
+}
+
+// Runs the consistency checker and, if confirmed, deletes the records behind
+// repairable issues.
+func runConsistencyCheck() {
+	buckets, err := loadConsistencyBuckets()
+	if err != nil {
+		return
+	}
+	issues := checkConsistency(buckets)
+	if len(issues) == 0 {
+		logInfof("no consistency issues found")
+		return
+	}
+
+	repairable := 0
+	fmt.Printf("\n%-28s %-12s %s\n", "ISSUE", "BUCKET", "DETAIL")
+	for _, issue := range issues {
+		fmt.Printf("%-28s %-12s %s\n", issue.Kind, issue.Bucket, issue.Detail)
+		if issue.Repairable {
+			repairable++
+		}
+	}
+	logInfof("found %d issues, %d repairable by deleting the offending record", len(issues), repairable)
+	if repairable == 0 {
+		return
+	}
+
+	if !confirmDestructive(fmt.Sprintf("delete %d records", repairable), "repair") {
+		return
+	}
+	repaired := 0
+	for _, issue := range issues {
+		if issue.Repairable && deleteBucketKey(issue.Bucket, issue.Key) == nil {
+			repaired++
+		}
+	}
+	logInfof("repaired %d of %d issues", repaired, repairable)
+}
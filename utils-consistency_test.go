@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func rawEntry(key string, value string) bucketEntry {
+	return bucketEntry{Key: []byte(key), Value: []byte(value)}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	buckets := map[string][]bucketEntry{
+		"USER_EMAIL": {
+			rawEntry("ann@email.com", "U1"),
+			rawEntry("Ann@Email.com", "U4"),
+			rawEntry("bob@email.com", "U2"),
+		},
+		"USER_AUTH": {
+			rawEntry("U1", `{"email":"ann@email.com","loginCode":0,"loginAttempts":0}`),
+			rawEntry("U3", `{"email":"gone@email.com","loginCode":0,"loginAttempts":0}`),
+			rawEntry("U4", `{"email":"Ann@Email.com","loginCode":123456,"loginAttempts":3}`),
+		},
+		"MOD_EXIM": {
+			rawEntry("E1", `{"eximId":"E1","author":"U1"}`),
+			rawEntry("E2", `{"eximId":"E2","author":"U9"}`),
+		},
+	}
+	issues := checkConsistency(buckets)
+
+	want := map[string]string{
+		issueOrphanedAuth:   "U3",
+		issueMissingAuth:    "bob@email.com",
+		issueOrphanedExim:   "E2",
+		issueDuplicateEmail: "Ann@Email.com",
+		issueStaleLogin:     "U4",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("got %d issues, want %d: %+v", len(issues), len(want), issues)
+	}
+	for _, issue := range issues {
+		if string(issue.Key) != want[issue.Kind] {
+			t.Errorf("%s key = %q, want %q", issue.Kind, issue.Key, want[issue.Kind])
+		}
+		wantRepairable := issue.Kind != issueDuplicateEmail && issue.Kind != issueStaleLogin
+		if issue.Repairable != wantRepairable {
+			t.Errorf("%s repairable = %v, want %v", issue.Kind, issue.Repairable, wantRepairable)
+		}
+	}
+}
+
+func TestCheckConsistencyClean(t *testing.T) {
+	newFakeApi(t)
+	_, token := loginNewUser(t)
+	createExim(token)
+	buckets, err := loadConsistencyBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issues := checkConsistency(buckets); len(issues) != 0 {
+		t.Errorf("clean fake reported issues: %+v", issues)
+	}
+}
+
+func TestRunConsistencyCheckRepair(t *testing.T) {
+	f := newFakeApi(t)
+	loginNewUser(t)
+	f.extraEntries["USER_AUTH"] = []fakeBucketEntry{{Key: []byte("01ORPHAN"), Value: []byte(`{}`)}}
+	f.extraEntries["MOD_EXIM"] = []fakeBucketEntry{{Key: []byte("01EXIMX"), Value: []byte(`{"author":"01NOBODY"}`)}}
+
+	// Declining leaves the records in place.
+	withInput(t, "no")
+	runConsistencyCheck()
+	buckets, _ := loadConsistencyBuckets()
+	if n := len(checkConsistency(buckets)); n != 2 {
+		t.Fatalf("issues after declined repair = %d, want 2", n)
+	}
+
+	withInput(t, "repair")
+	runConsistencyCheck()
+	buckets, _ = loadConsistencyBuckets()
+	if issues := checkConsistency(buckets); len(issues) != 0 {
+		t.Errorf("issues after repair: %+v", issues)
+	}
+	if !f.deletedKeys["USER_AUTH"]["01ORPHAN"] || !f.deletedKeys["MOD_EXIM"]["01EXIMX"] {
+		t.Errorf("deleted keys = %v", f.deletedKeys)
+	}
+	for name, keys := range f.deletedKeys {
+		for key := range keys {
+			if !strings.HasPrefix(key, "01ORPHAN") && !strings.HasPrefix(key, "01EXIMX") {
+				t.Errorf("repair deleted unrelated key %s/%s", name, key)
+			}
+		}
+	}
+}
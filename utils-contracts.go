@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Response bodies of cp-api's endpoints, which are their contracts: fields
+// cp-api adds, drops or retypes are reported as drift. Fields tagged
+// omitempty (such as error, only sent on failure) may be absent.
+
+type errorResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+type signupResponse struct {
+	UserId string `json:"userId"`
+	Error  string `json:"error,omitempty"`
+}
+
+type loginResponse struct {
+	UserId string `json:"userId"`
+	Error  string `json:"error,omitempty"`
+}
+
+type loginCodeResponse struct {
+	Token             string `json:"token"`
+	RemainingAttempts int    `json:"remainingAttempts"`
+	Error             string `json:"error,omitempty"`
+}
+
+type bypassEmailResponse struct {
+	LoginCode     int       `json:"loginCode"`
+	LoginAttempts int       `json:"loginAttempts"`
+	LogoutTs      time.Time `json:"logoutTs"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type createEximResponse struct {
+	EximId string `json:"eximId"`
+	Error  string `json:"error,omitempty"`
+}
+
+type eximDetailsResponse struct {
+	EximId     string `json:"eximId"`
+	Author     string `json:"author"`
+	IsApproved bool   `json:"isApproved"`
+	Target     string `json:"target"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary"`
+	Paragraph1 string `json:"paragraph1"`
+	Paragraph2 string `json:"paragraph2"`
+	Paragraph3 string `json:"paragraph3"`
+	Link       string `json:"link"`
+	Error      string `json:"error,omitempty"`
+}
+
+type eximsResponse struct {
+	Exims []eximRecord `json:"exims"`
+	Error string       `json:"error,omitempty"`
+}
+
+type createAdminResponse struct {
+	AdminId string `json:"adminId"`
+	Error   string `json:"error,omitempty"`
+}
+
+type userResponse struct {
+	User  adminUser `json:"user"`
+	Error string    `json:"error,omitempty"`
+}
+
+type bucketsResponse struct {
+	Buckets []bucketInfo `json:"buckets"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type bucketScanResponse struct {
+	Bucket  string        `json:"bucket"`
+	Entries []bucketEntry `json:"entries"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type bucketEntryResponse struct {
+	Entry bucketEntry `json:"entry"`
+	Error string      `json:"error,omitempty"`
+}
+
+// Request bodies cp-admin sends.
+
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+type loginCodeRequest struct {
+	UserId string `json:"userId"`
+	Code   int    `json:"code"`
+}
+
+type logoutRequest struct {
+	UserId string `json:"userId"`
+}
+
+type createAdminRequest struct {
+	Email string `json:"email"`
+	// PEM encoded PKCS #1 RSA public key.
+	PublicKey string `json:"publicKey"`
+}
+
+// An endpoint, what it takes and what it responds with. Route segments in
+// braces match any single path segment.
+type apiContract struct {
+	Method  string
+	Route   string
+	Summary string
+	// "bearer" for a user's session token, "admin" for Admin-Authorization,
+	// or empty for public endpoints.
+	Auth  string
+	Query []string
+	// Request body, if any.
+	Request interface{}
+	// Status returned on success, with Response as its body (nil for none,
+	// or a binary body when Binary is set).
+	Status   int
+	Response interface{}
+	Binary   bool
+	// Set for endpoints cp-admin assumes cp-api provides but that aren't
+	// confirmed in cp-api; their routes and bodies are cp-admin's own guess.
+	Assumed bool
+	// Query parameters assumed the same way on an otherwise known endpoint.
+	AssumedQuery []string
+}
+
+// Every cp-api endpoint cp-admin calls. More specific routes come first.
+// Endpoints marked Assumed are cp-admin's assumptions about cp-api.
+var apiContracts = []apiContract{
+	{Method: "POST", Route: "/api/user/signup/", Summary: "Sign up a new user", Request: emailRequest{}, Status: 201, Response: signupResponse{}},
+	{Method: "POST", Route: "/api/user/login/", Summary: "Start a login, emailing a login code", Request: emailRequest{}, Status: 200, Response: loginResponse{}},
+	{Method: "POST", Route: "/api/user/login-code/", Summary: "Exchange a login code for a session token", Request: loginCodeRequest{}, Status: 200, Response: loginCodeResponse{}},
+	{Method: "POST", Route: "/api/user/logout/", Summary: "End the user's sessions", Auth: "bearer", Request: logoutRequest{}, Status: 204},
+	{Method: "POST", Route: "/api/exim/create/", Summary: "Create an exim", Auth: "bearer", Request: eximFields{}, Status: 201, Response: createEximResponse{}},
+	{Method: "GET", Route: "/api/exim/{eximId}", Summary: "Get an exim", Status: 200, Response: eximDetailsResponse{}},
+	{Method: "GET", Route: "/api/exims", Summary: "List approved exims", Status: 200, Response: eximsResponse{}},
+	{Method: "GET", Route: "/api/admin/bypass-email/{userId}", Summary: "Get a user's login code without email", Auth: "admin", Status: 200, Response: bypassEmailResponse{}},
+	{Method: "POST", Route: "/api/admin/shutdown/", Summary: "Shut the API server down", Auth: "admin", Query: []string{"drain"}, AssumedQuery: []string{"drain"}, Status: 204},
+	{Method: "GET", Route: "/api/admin/backup", Summary: "Stream a consistent database snapshot", Auth: "admin", Status: 200, Binary: true, Assumed: true},
+	{Method: "GET", Route: "/api/admin/exims", Summary: "List exims by approval", Auth: "admin", Query: []string{"approved"}, Status: 200, Response: eximsResponse{}, Assumed: true},
+	{Method: "POST", Route: "/api/admin/approve-exim/{eximId}", Summary: "Approve an exim", Auth: "admin", Status: 204, Assumed: true},
+	{Method: "POST", Route: "/api/admin/reject-exim/{eximId}", Summary: "Reject an exim", Auth: "admin", Status: 204, Assumed: true},
+	{Method: "POST", Route: "/api/admin/admins", Summary: "Register an admin's public key", Auth: "admin", Request: createAdminRequest{}, Status: 201, Response: createAdminResponse{}, Assumed: true},
+	{Method: "DELETE", Route: "/api/admin/admins/{adminId}", Summary: "Revoke an admin", Auth: "admin", Status: 204, Assumed: true},
+	{Method: "GET", Route: "/api/admin/user/{user}", Summary: "Look up a user by email or ULID", Auth: "admin", Status: 200, Response: userResponse{}, Assumed: true},
+	{Method: "POST", Route: "/api/admin/user/{userId}/{action}", Summary: "Reset login attempts, log out, disable or enable a user", Auth: "admin", Status: 204, Assumed: true},
+	{Method: "DELETE", Route: "/api/admin/user/{user}", Summary: "Delete a user by ULID and, optionally, their exims", Auth: "admin", Query: []string{"exims"}, Status: 204, Assumed: true},
+	{Method: "GET", Route: "/api/admin/buckets", Summary: "List buckets and their key counts", Auth: "admin", Status: 200, Response: bucketsResponse{}, Assumed: true},
+	{Method: "GET", Route: "/api/admin/bucket/{bucket}/key", Summary: "Get a bucket entry", Auth: "admin", Query: []string{"key"}, Status: 200, Response: bucketEntryResponse{}, Assumed: true},
+	{Method: "DELETE", Route: "/api/admin/bucket/{bucket}/key", Summary: "Delete a bucket entry", Auth: "admin", Query: []string{"key"}, Status: 204, Assumed: true},
+	{Method: "GET", Route: "/api/admin/bucket/{bucket}", Summary: "Scan a bucket's entries", Auth: "admin", Query: []string{"prefix", "start", "end", "limit"}, Status: 200, Response: bucketScanResponse{}, Assumed: true},
+}
+
+// How drift from a contract is handled in each profile: "strict" stops the
+// command, "lenient" warns and decodes what it can. -contracts overrides it.
+var contractModes = map[string]string{
+	"local":      "strict",
+	"production": "lenient",
+}
+
+var contractModeOverride string
+
+func contractMode() string {
+	if contractModeOverride != "" {
+		return contractModeOverride
+	}
+	if mode, ok := contractModes[activeProfile]; ok {
+		return mode
+	}
+	return "strict"
+}
+
+func routeMatches(route string, path string) bool {
+	routeSegments := strings.Split(strings.Trim(route, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(routeSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range routeSegments {
+		if !strings.HasPrefix(segment, "{") && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Expected JSON type of a field, by dotted path ("exims[].title").
+type fieldSpec struct {
+	Type     string
+	Optional bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Returns the JSON fields a Go type decodes from.
+func schemaOf(t reflect.Type) map[string]fieldSpec {
+	fields := make(map[string]fieldSpec)
+	addSchema(fields, "", t, false)
+	return fields
+}
+
+func addSchema(fields map[string]fieldSpec, path string, t reflect.Type, optional bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	jsonType := jsonTypeOf(t)
+	if path != "" {
+		fields[path] = fieldSpec{Type: jsonType, Optional: optional}
+	}
+	switch jsonType {
+	case "array":
+		addSchema(fields, path+"[]", t.Elem(), false)
+	case "object":
+		if t.Kind() != reflect.Struct {
+			// Maps have free-form keys.
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			addSchema(fields, fieldPath, f.Type, strings.Contains(opts, "omitempty"))
+		}
+	}
+}
+
+func jsonTypeOf(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is sent base64 encoded.
+			return "string"
+		}
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "any"
+}
+
+// Returns the fields present in a decoded JSON value, by dotted path.
+func observedSchema(v interface{}) map[string]string {
+	fields := make(map[string]string)
+	addObserved(fields, "", v)
+	return fields
+}
+
+func addObserved(fields map[string]string, path string, v interface{}) {
+	jsonType := "null"
+	switch v := v.(type) {
+	case string:
+		jsonType = "string"
+	case bool:
+		jsonType = "boolean"
+	case float64:
+		jsonType = "number"
+	case []interface{}:
+		jsonType = "array"
+		for _, elem := range v {
+			addObserved(fields, path+"[]", elem)
+		}
+	case map[string]interface{}:
+		jsonType = "object"
+		for name, fieldValue := range v {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			addObserved(fields, fieldPath, fieldValue)
+		}
+	}
+	if path != "" && (fields[path] == "" || fields[path] == "null") {
+		fields[path] = jsonType
+	}
+}
+
+// A difference between a contract and a response.
+type fieldDrift struct {
+	Path string
+	// "added", "removed" or "retyped".
+	Kind     string
+	Expected string
+	Observed string
+}
+
+func (d fieldDrift) String() string {
+	switch d.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s (%s)", d.Path, d.Observed)
+	case "removed":
+		return fmt.Sprintf("- %s (%s)", d.Path, d.Expected)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", d.Path, d.Expected, d.Observed)
+}
+
+// Returns the container a field path belongs to: "" for top-level fields.
+func parentPath(path string) string {
+	if strings.HasSuffix(path, "[]") {
+		return strings.TrimSuffix(path, "[]")
+	}
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// Compares the fields of a response with its contract, sorted by path.
+func diffSchema(expected map[string]fieldSpec, observed map[string]string) []fieldDrift {
+	var drifts []fieldDrift
+	for path, observedType := range observed {
+		spec, ok := expected[path]
+		if !ok {
+			if !freeForm(expected, path) {
+				drifts = append(drifts, fieldDrift{Path: path, Kind: "added", Observed: observedType})
+			}
+			continue
+		}
+		if observedType != "null" && spec.Type != "any" && spec.Type != observedType {
+			drifts = append(drifts, fieldDrift{Path: path, Kind: "retyped", Expected: spec.Type, Observed: observedType})
+		}
+	}
+	for path, spec := range expected {
+		if _, ok := observed[path]; ok || spec.Optional {
+			continue
+		}
+		// Only report fields whose container was sent; empty arrays say
+		// nothing about their elements.
+		parent := parentPath(path)
+		if strings.HasSuffix(path, "[]") || (parent != "" && observed[parent] != "object") {
+			continue
+		}
+		drifts = append(drifts, fieldDrift{Path: path, Kind: "removed", Expected: spec.Type})
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Path < drifts[j].Path })
+	return drifts
+}
+
+// Reports whether path lies under a map or untyped field, whose contents
+// aren't part of the contract.
+func freeForm(expected map[string]fieldSpec, path string) bool {
+	for parent := parentPath(path); parent != ""; parent = parentPath(parent) {
+		spec, ok := expected[parent]
+		if ok && (spec.Type == "any" || (spec.Type == "object" && !hasChildren(expected, parent))) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasChildren(fields map[string]fieldSpec, parent string) bool {
+	for path := range fields {
+		if strings.HasPrefix(path, parent+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares a JSON response body with the type it's decoded into.
+func contractDrift(body []byte, dst interface{}) ([]fieldDrift, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	return diffSchema(schemaOf(reflect.TypeOf(dst)), observedSchema(v)), nil
+}
+
+func withoutRemoved(drifts []fieldDrift) []fieldDrift {
+	var kept []fieldDrift
+	for _, d := range drifts {
+		if d.Kind != "removed" {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func formatDrifts(drifts []fieldDrift) string {
+	lines := make([]string, len(drifts))
+	for i, d := range drifts {
+		lines[i] = "    " + d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Decodes the JSON response body into dst, checking it against dst's
+// contract first. Drift exits in strict mode and is reported in lenient
+// mode; a body that can't be decoded at all exits in either.
+func unmarshalOrExit(res *http.Response, dst interface{}) {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		logErrorf("reading response body: %v", err)
+		os.Exit(1)
+	}
+
+	endpoint := "response"
+	if res.Request != nil {
+		endpoint = res.Request.Method + " " + res.Request.URL.Path
+	}
+	drifts, err := contractDrift(body, dst)
+	if res.StatusCode >= 300 {
+		// Failed requests send an error and only some of the other fields.
+		drifts = withoutRemoved(drifts)
+	}
+	if err == nil && len(drifts) > 0 {
+		if contractMode() == "strict" {
+			logErrorf("%s differs from its contract (run with -contracts=lenient to continue anyway):\n%s", endpoint, formatDrifts(drifts))
+			if recordPath != "" {
+				logErrorf("the response is recorded in %s; see Browse Recorded Session", recordPath)
+			}
+			os.Exit(1)
+		}
+		logWarnf("%s differs from its contract:\n%s", endpoint, formatDrifts(drifts))
+	}
+
+	if err == nil {
+		err = json.Unmarshal(body, dst)
+	}
+	if err != nil {
+		logErrorf("decoding & unmarshaling JSON from %s: %v", endpoint, err)
+		if recordPath != "" {
+			logErrorf("the response is recorded in %s; see Browse Recorded Session", recordPath)
+		}
+		os.Exit(1)
+	}
+}
+
+// Drift found for one endpoint across the responses checked.
+type contractReport struct {
+	Contract  apiContract
+	Responses int
+	Drifts    []string
+}
+
+// Checks successful responses among exchanges against their contracts,
+// returning a report per contract in apiContracts order.
+func checkContracts(exchanges []recordedExchange) []contractReport {
+	reports := make([]contractReport, len(apiContracts))
+	seen := make([]map[string]bool, len(apiContracts))
+	for i, c := range apiContracts {
+		reports[i].Contract = c
+		seen[i] = make(map[string]bool)
+	}
+	for _, e := range exchanges {
+		if e.Status < 200 || e.Status >= 300 || e.ResponseBody == "" {
+			continue
+		}
+		path := recordedPath(e.Url)
+		path, _, _ = strings.Cut(path, "?")
+		for i, c := range apiContracts {
+			if c.Method != e.Method || !routeMatches(c.Route, path) {
+				continue
+			}
+			if c.Response == nil {
+				break
+			}
+			reports[i].Responses++
+			drifts, err := contractDrift([]byte(e.ResponseBody), c.Response)
+			if err != nil {
+				drifts = []fieldDrift{{Path: "(body)", Kind: "retyped", Expected: "JSON", Observed: err.Error()}}
+			}
+			for _, d := range drifts {
+				if !seen[i][d.String()] {
+					seen[i][d.String()] = true
+					reports[i].Drifts = append(reports[i].Drifts, d.String())
+				}
+			}
+			break
+		}
+	}
+	return reports
+}
+
+func printContractReports(reports []contractReport) {
+	for _, r := range reports {
+		endpoint := r.Contract.Method + " " + r.Contract.Route
+		switch {
+		case r.Contract.Response == nil:
+			// Nothing to check in an empty or binary body.
+			continue
+		case r.Responses == 0:
+			fmt.Printf("%-44s not seen\n", endpoint)
+		case len(r.Drifts) == 0:
+			fmt.Printf("%-44s ok (%d responses)\n", endpoint, r.Responses)
+		default:
+			fmt.Printf("%-44s [err] drift in %d responses\n", endpoint, r.Responses)
+			for _, d := range r.Drifts {
+				fmt.Printf("    %s\n", d)
+			}
+		}
+	}
+}
+
+// Fetches cp-api's read-only endpoints, returning them as exchanges.
+func fetchLiveExchanges() []recordedExchange {
+	paths := []string{"/api/exims", "/api/admin/exims?approved=false", "/api/admin/buckets"}
+	var exchanges []recordedExchange
+	fetch := func(path string) recordedExchange {
+		e := recordedExchange{Method: "GET", Url: apiBaseUrl + path}
+		req, err := http.NewRequest("GET", e.Url, nil)
+		if err != nil {
+			e.Error = err.Error()
+			return e
+		}
+		if strings.HasPrefix(path, "/api/admin/") {
+			setAdminHeaders(req)
+		}
+		res, err := apiClient.Do(req)
+		if err != nil {
+			e.Error = err.Error()
+			return e
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		e.Status, e.ResponseBody = res.StatusCode, string(body)
+		return e
+	}
+	for _, path := range paths {
+		e := fetch(path)
+		if e.Error != "" {
+			logErrorf("fetching %s: %s", path, e.Error)
+		}
+		exchanges = append(exchanges, e)
+
+		// Check an exim's details too, if any are listed.
+		var exims eximsResponse
+		if path == "/api/exims" && json.Unmarshal([]byte(e.ResponseBody), &exims) == nil && len(exims.Exims) > 0 {
+			exchanges = append(exchanges, fetch("/api/exim/"+exims.Exims[0].EximId))
+		}
+	}
+	return exchanges
+}
+
+// Checks cp-api's responses against cp-admin's contracts, either live from
+// the read-only endpoints or from a recorded session, and reports drift per
+// endpoint.
+func runContractCheck() {
+	source := promptWithDefault("Check live responses or a session file (live or path)", "live")
+	var exchanges []recordedExchange
+	if source == "live" {
+		exchanges = fetchLiveExchanges()
+	} else {
+		var err error
+		exchanges, err = readRecording(source)
+		if err != nil {
+			logErrorf("reading session: %v", err)
+			return
+		}
+	}
+	reports := checkContracts(exchanges)
+	printContractReports(reports)
+
+	drifted := 0
+	for _, r := range reports {
+		if len(r.Drifts) > 0 {
+			drifted++
+		}
+	}
+	if drifted > 0 {
+		logWarnf("%d endpoints differ from their contracts", drifted)
+	} else {
+		logInfof("no contract drift found")
+	}
+}
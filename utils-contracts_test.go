@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func jsonResponse(status int, body string) *http.Response {
+	req, _ := http.NewRequest("GET", "http://api.test/api/exims", nil)
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Request: req}
+}
+
+func TestUnmarshalOrExit(t *testing.T) {
+	var dst signupResponse
+	unmarshalOrExit(jsonResponse(200, `{"userId":"abc"}`), &dst)
+	if dst.UserId != "abc" {
+		t.Errorf("UserId = %q, want %q", dst.UserId, "abc")
+	}
+}
+
+func TestUnmarshalOrExitLenient(t *testing.T) {
+	old := contractModeOverride
+	t.Cleanup(func() { contractModeOverride = old })
+	contractModeOverride = "lenient"
+
+	var dst signupResponse
+	out := captureOutput(t, func() {
+		unmarshalOrExit(jsonResponse(200, `{"userId":"abc","nickname":"al"}`), &dst)
+	})
+	if dst.UserId != "abc" {
+		t.Errorf("UserId = %q, want %q", dst.UserId, "abc")
+	}
+	if !strings.Contains(out, "WARN  GET /api/exims differs from its contract") || !strings.Contains(out, "+ nickname (string)") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+func TestContractMode(t *testing.T) {
+	oldOverride, oldProfile := contractModeOverride, activeProfile
+	t.Cleanup(func() { contractModeOverride, activeProfile = oldOverride, oldProfile })
+
+	contractModeOverride = ""
+	for profile, want := range map[string]string{"local": "strict", "production": "lenient", "staging": "strict"} {
+		activeProfile = profile
+		if got := contractMode(); got != want {
+			t.Errorf("%s: mode = %q, want %q", profile, got, want)
+		}
+	}
+	contractModeOverride = "lenient"
+	activeProfile = "local"
+	if got := contractMode(); got != "lenient" {
+		t.Errorf("override: mode = %q", got)
+	}
+}
+
+func TestContractDrift(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	type response struct {
+		Items []item            `json:"items"`
+		Meta  map[string]string `json:"meta"`
+		Note  string            `json:"note,omitempty"`
+		Error string            `json:"error,omitempty"`
+	}
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"items":[{"name":"a","count":1}],"meta":{"x":"y"}}`, nil},
+		// Empty arrays and nulls say nothing about what they'd hold.
+		{`{"items":[],"meta":null}`, nil},
+		{`{"items":[{"name":"a","count":"1","color":"red"}],"meta":{}}`, []string{"+ items[].color (string)", "~ items[].count: number -> string"}},
+		{`{"meta":{},"total":3}`, []string{"- items (array)", "+ total (number)"}},
+		{`{"items":[{"name":"a"}],"meta":{}}`, []string{"- items[].count (number)"}},
+	}
+	for _, tt := range tests {
+		drifts, err := contractDrift([]byte(tt.body), response{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range drifts {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: drift = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		route, path string
+		want        bool
+	}{
+		{"/api/exims", "/api/exims", true},
+		{"/api/exim/{eximId}", "/api/exim/01ABC", true},
+		{"/api/user/signup/", "/api/user/signup", true},
+		{"/api/admin/bucket/{bucket}", "/api/admin/bucket/users/key", false},
+		{"/api/admin/bucket/{bucket}/key", "/api/admin/bucket/users/key", true},
+	}
+	for _, tt := range tests {
+		if got := routeMatches(tt.route, tt.path); got != tt.want {
+			t.Errorf("routeMatches(%q, %q) = %v", tt.route, tt.path, got)
+		}
+	}
+}
+
+func TestCheckContracts(t *testing.T) {
+	exchanges := []recordedExchange{
+		{Method: "GET", Url: "http://api.test/api/exims", Status: 200, ResponseBody: `{"exims":[]}`},
+		{Method: "GET", Url: "http://api.test/api/exims", Status: 200, ResponseBody: `{"exims":[],"total":0}`},
+		{Method: "POST", Url: "http://api.test/api/user/signup/", Status: 400, ResponseBody: `{"error":"taken"}`},
+		{Method: "GET", Url: "http://api.test/api/admin/bucket/users/key?key=AA", Status: 200, ResponseBody: `{"entry":{"key":"AA","value":"AA"}}`},
+	}
+	reports := checkContracts(exchanges)
+	byRoute := make(map[string]contractReport)
+	for _, r := range reports {
+		byRoute[r.Contract.Method+" "+r.Contract.Route] = r
+	}
+	if r := byRoute["GET /api/exims"]; r.Responses != 2 || !reflect.DeepEqual(r.Drifts, []string{"+ total (number)"}) {
+		t.Errorf("exims report = %+v", r)
+	}
+	if r := byRoute["POST /api/user/signup/"]; r.Responses != 0 {
+		t.Errorf("failed signup was checked: %+v", r)
+	}
+	if r := byRoute["GET /api/admin/bucket/{bucket}/key"]; r.Responses != 1 {
+		t.Errorf("bucket key report = %+v", r)
+	}
+}
+
+func TestRunContractCheckLive(t *testing.T) {
+	newFakeApi(t)
+	_, token := loginNewUser(t)
+	createExim(token)
+
+	withInput(t, "live")
+	out := captureOutput(t, runContractCheck)
+	for _, want := range []string{"GET /api/exims", "GET /api/exim/{eximId}", "GET /api/admin/buckets", "no contract drift found"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[err]") {
+		t.Errorf("fake api drifted:\n%s", out)
+	}
+}
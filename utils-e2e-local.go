@@ -1,19 +1,47 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"time"
 )
 
+// Returns the host:port of the API server from apiBaseUrl.
+func apiAddr() string {
+	return baseUrlAddr(apiBaseUrl)
+}
+
+// Returns the host:port an API base URL points at.
+func baseUrlAddr(baseUrl string) string {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return "localhost:8000"
+	}
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			return u.Hostname() + ":443"
+		}
+		return u.Hostname() + ":80"
+	}
+	return u.Host
+}
+
+// Returns whether something accepts TCP connections at addr (host:port).
+func portOpen(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
 // Returns error if the API server is already running.
 func apiServerOffline() error {
-	conn, err := net.Dial("tcp", "localhost:8000")
-	if err == nil {
-		conn.Close()
+	if portOpen(apiAddr()) {
 		return fmt.Errorf("api server is already running")
 	}
 	return nil
@@ -25,23 +53,16 @@ func prepareDirectory(dir string) error {
 	// Check if the temp directory exists.
 	if _, err := os.Stat(dir); !os.IsNotExist(err) {
 		// Prompt the user.
-		fmt.Print("Directory already exists. Do you want to delete it? (y/n): ")
-		reader := bufio.NewReader(os.Stdin)
-		// Reads until the first occurrence of newline delimiter.
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("[err][admin] reading user input: %v [%s]\n", err, cts())
-			os.Exit(1)
-		}
+		input := promptLine("Directory already exists. Do you want to delete it? (y/n): ")
 
 		// If yes, delete the directory.
-		if input == "y\n" || input == "Y\n" {
-			err = os.RemoveAll(dir)
+		if input == "y" || input == "Y" {
+			err := os.RemoveAll(dir)
 			if err != nil {
-				fmt.Printf("[err][admin] deleting existing directory: %v [%s]\n", err, cts())
+				logErrorf("deleting existing directory: %v", err)
 				os.Exit(1)
 			}
-			fmt.Printf("[admin] directory deleted [%s]\n", cts())
+			logInfof("directory deleted")
 		} else {
 			// If no, return error.
 			return fmt.Errorf("user declined to delete existing directory")
@@ -51,10 +72,10 @@ func prepareDirectory(dir string) error {
 	// Create a new temp directory.
 	err := os.Mkdir(dir, 0755)
 	if err != nil {
-		fmt.Printf("[err][admin] creating temp directory: %v [%s]\n", err, cts())
+		logErrorf("creating temp directory: %v", err)
 		os.Exit(1)
 	}
-	fmt.Printf("[admin] new directory created: %v [%s]\n", dir, cts())
+	logInfof("new directory created: %v", dir)
 
 	return nil
 }
@@ -96,11 +117,17 @@ func runEndToEndSequence() {
 }
 
 func runEndToEndLocal() {
+	// Everything below clones cp-api and runs a real server, which a skipped
+	// shutdown would leave running with this command waiting on it.
+	if dryRunSkip("clone cp-api into temp-e2e, run it and exercise its endpoints") {
+		return
+	}
+
 	// The API server will be started in a subprocess below. If it is already
 	// running in another process, abort this test.
 	err := apiServerOffline()
 	if err != nil {
-		fmt.Printf("[err][admin] confirming server is offline: %v [%s]\n", err, cts())
+		logErrorf("confirming server is offline: %v", err)
 		return
 	}
 
@@ -108,7 +135,7 @@ func runEndToEndLocal() {
 	dir := "temp-e2e"
 	err = prepareDirectory(dir)
 	if err != nil {
-		fmt.Printf("[err][admin] preparing directory: %v [%s]\n", err, cts())
+		logErrorf("preparing directory: %v", err)
 		os.Exit(1)
 	}
 
@@ -121,7 +148,7 @@ func runEndToEndLocal() {
 	// Run command and wait for it to complete.
 	err = goGetCmd.Run()
 	if err != nil {
-		fmt.Printf("[err][admin] running git clone command (silently): %v [%s]\n", err, cts())
+		logErrorf("running git clone command (silently): %v", err)
 		os.Exit(1)
 	}
 
@@ -131,17 +158,20 @@ func runEndToEndLocal() {
 	runCmd.Dir = fmt.Sprintf("%s/%s", dir, subDir)
 	runCmd.Stdout = os.Stdout
 	runCmd.Stderr = os.Stderr
-	runCmd.Env = append(os.Environ(), fmt.Sprintf("ADMIN_ONE_EMAIL=%s", os.Getenv("ADMIN_ONE_EMAIL")))
-	runCmd.Env = append(os.Environ(), fmt.Sprintf("ADMIN_ONE_ULID=%s", os.Getenv("ADMIN_ONE_ULID")))
+	// Seed the e2e server with the acting admin so its signed calls are accepted.
+	runCmd.Env = append(os.Environ(),
+		fmt.Sprintf("ADMIN_ONE_EMAIL=%s", actingAdmin.Email),
+		fmt.Sprintf("ADMIN_ONE_ULID=%s", actingAdmin.AdminId),
+	)
 
 	// Start server but don't wait in order to proceed with testing.
 	err = runCmd.Start()
 	if err != nil {
-		fmt.Printf("[err][admin] starting an exec.Command: %v [%s]\n", err, cts())
+		logErrorf("starting an exec.Command: %v", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("[admin] subprocess exec.Command has PID: %d [%s]\n", runCmd.Process.Pid, cts())
+	logInfof("subprocess exec.Command has PID: %d", runCmd.Process.Pid)
 
 	// Delay a bit while server starts.
 	for i := 0; i < 10; i++ {
@@ -160,7 +190,7 @@ func runEndToEndLocal() {
 	// Wait for previously started command to exit.
 	err = runCmd.Wait()
 	if err != nil {
-		fmt.Printf("[err][admin] waiting for exec.Command to exit: %v [%s]\n", err, cts())
+		logErrorf("waiting for exec.Command to exit: %v", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunEndToEndSequence(t *testing.T) {
+	f := newFakeApi(t)
+	runEndToEndSequence()
+	if len(f.users) != 1 {
+		t.Errorf("users = %d, want 1", len(f.users))
+	}
+	if len(f.exims) != 1 {
+		t.Errorf("exims = %d, want 1", len(f.exims))
+	}
+	if len(f.tokens) != 0 {
+		t.Errorf("live tokens = %d, want 0 after logout", len(f.tokens))
+	}
+}
+
+func TestRunEndToEndLocalDryRun(t *testing.T) {
+	withGuards(t, "local", true)
+	wd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(wd) })
+	os.Chdir(t.TempDir())
+
+	captureOutput(t, runEndToEndLocal)
+	if _, err := os.Stat("temp-e2e"); !os.IsNotExist(err) {
+		t.Errorf("dry run prepared temp-e2e: %v", err)
+	}
+}
+
+func TestPrepareDirectoryPrompts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "temp-e2e")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "stale"), nil, 0644)
+
+	withInput(t, "n")
+	captureOutput(t, func() {
+		if prepareDirectory(dir) == nil {
+			t.Error("declined prompt still prepared the directory")
+		}
+	})
+	withInput(t, "Y")
+	captureOutput(t, func() {
+		if err := prepareDirectory(dir); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if _, err := os.Stat(filepath.Join(dir, "stale")); !os.IsNotExist(err) {
+		t.Errorf("existing directory was not replaced: %v", err)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Columns of an exim CSV file, in the order they are written.
+var eximCsvColumns = []string{"eximId", "author", "isApproved", "target", "title", "summary", "paragraph1", "paragraph2", "paragraph3", "link"}
+
+// Separates exims in a Markdown file.
+const eximMarkdownSeparator = "\n---\n"
+
+// Returns the format of an exim file from its extension: json, csv or md.
+func eximFileFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".csv":
+		return "csv", nil
+	case ".md", ".markdown":
+		return "md", nil
+	}
+	return "", fmt.Errorf("%s: unknown exim file format (use .json, .csv or .md)", path)
+}
+
+func eximCsvRecord(e eximRecord) []string {
+	return []string{e.EximId, e.Author, strconv.FormatBool(e.IsApproved), e.Target, e.Title, e.Summary, e.Paragraph1, e.Paragraph2, e.Paragraph3, e.Link}
+}
+
+// Writes exims as Markdown: one "# title" section per exim with its metadata
+// as a list and each text field under its own heading. Empty paragraphs are
+// left out.
+func writeEximsMarkdown(w io.Writer, exims []eximRecord) error {
+	b := bufio.NewWriter(w)
+	for i, e := range exims {
+		if i > 0 {
+			b.WriteString(eximMarkdownSeparator + "\n")
+		}
+		fmt.Fprintf(b, "# %s\n\n", e.Title)
+		fmt.Fprintf(b, "- eximId: %s\n- author: %s\n- approved: %t\n- target: %s\n- link: %s\n", e.EximId, e.Author, e.IsApproved, e.Target, e.Link)
+		for _, section := range []struct{ heading, text string }{
+			{"Summary", e.Summary},
+			{"Paragraph 1", e.Paragraph1},
+			{"Paragraph 2", e.Paragraph2},
+			{"Paragraph 3", e.Paragraph3},
+		} {
+			if section.text != "" {
+				fmt.Fprintf(b, "\n## %s\n\n%s\n", section.heading, section.text)
+			}
+		}
+	}
+	return b.Flush()
+}
+
+// Writes exims to path in the format its extension names.
+func writeEximFile(path string, exims []eximRecord) error {
+	format, err := eximFileFormat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(eximsResponse{Exims: exims})
+	case "csv":
+		w := csv.NewWriter(f)
+		w.Write(eximCsvColumns)
+		for _, e := range exims {
+			w.Write(eximCsvRecord(e))
+		}
+		w.Flush()
+		err = w.Error()
+	case "md":
+		err = writeEximsMarkdown(f, exims)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Reads exims from CSV. Columns are matched by header name and may be in any
+// order; unknown columns are an error so typos aren't silently dropped.
+func readEximsCsv(r io.Reader) ([]eximRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	for _, col := range rows[0] {
+		if !slices.Contains(eximCsvColumns, col) {
+			return nil, fmt.Errorf("unknown column %q (expected some of %s)", col, strings.Join(eximCsvColumns, ", "))
+		}
+	}
+	var exims []eximRecord
+	for _, row := range rows[1:] {
+		fields := make(map[string]string)
+		for i, col := range rows[0] {
+			fields[col] = row[i]
+		}
+		approved, _ := strconv.ParseBool(fields["isApproved"])
+		exims = append(exims, eximRecord{
+			EximId:     fields["eximId"],
+			Author:     fields["author"],
+			IsApproved: approved,
+			Target:     fields["target"],
+			Title:      fields["title"],
+			Summary:    fields["summary"],
+			Paragraph1: fields["paragraph1"],
+			Paragraph2: fields["paragraph2"],
+			Paragraph3: fields["paragraph3"],
+			Link:       fields["link"],
+		})
+	}
+	return exims, nil
+}
+
+// Reads exims in the layout writeEximsMarkdown produces.
+func readEximsMarkdown(text string) ([]eximRecord, error) {
+	var exims []eximRecord
+	for i, block := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), eximMarkdownSeparator) {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		var e eximRecord
+		var section *string
+		var text []string
+		flush := func() {
+			if section != nil {
+				*section = strings.TrimSpace(strings.Join(text, "\n"))
+			}
+			section, text = nil, nil
+		}
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "# ") && e.Title == "" && section == nil:
+				e.Title = strings.TrimSpace(line[2:])
+			case strings.HasPrefix(line, "## "):
+				flush()
+				switch strings.TrimSpace(line[3:]) {
+				case "Summary":
+					section = &e.Summary
+				case "Paragraph 1":
+					section = &e.Paragraph1
+				case "Paragraph 2":
+					section = &e.Paragraph2
+				case "Paragraph 3":
+					section = &e.Paragraph3
+				default:
+					return nil, fmt.Errorf("exim %d: unknown section %q", i+1, line)
+				}
+			case section != nil:
+				text = append(text, line)
+			case strings.HasPrefix(line, "- "):
+				key, value, _ := strings.Cut(line[2:], ":")
+				value = strings.TrimSpace(value)
+				switch strings.TrimSpace(key) {
+				case "eximId":
+					e.EximId = value
+				case "author":
+					e.Author = value
+				case "approved":
+					e.IsApproved = value == "true"
+				case "target":
+					e.Target = value
+				case "link":
+					e.Link = value
+				default:
+					return nil, fmt.Errorf("exim %d: unknown field %q", i+1, key)
+				}
+			}
+		}
+		flush()
+		exims = append(exims, e)
+	}
+	return exims, nil
+}
+
+// Reads exims from path in the format its extension names. JSON files may
+// hold either a list of exims or an /api/exims response.
+func readEximFile(path string) ([]eximRecord, error) {
+	format, err := eximFileFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var exims []eximRecord
+	switch format {
+	case "json":
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+			err = json.Unmarshal(data, &exims)
+		} else {
+			var res eximsResponse
+			err = json.Unmarshal(data, &res)
+			exims = res.Exims
+		}
+	case "csv":
+		exims, err = readEximsCsv(strings.NewReader(string(data)))
+	case "md":
+		exims, err = readEximsMarkdown(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return exims, nil
+}
+
+// Checks that a link is an absolute http(s) URL.
+func validateEximLink(link string) error {
+	u, err := neturl.Parse(link)
+	if err != nil || strings.ContainsAny(link, " \t\n") {
+		return fmt.Errorf("link %q is not a valid url", link)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("link %q must be an http(s) url with a host", link)
+	}
+	return nil
+}
+
+// Returns the problems found checking the exim against cp-admin's assumed
+// targets and length limits (see eximTargets), which cp-api may not share.
+func validateEximFields(e eximFields) []string {
+	var problems []string
+	if !slices.Contains(eximTargets, e.Target) {
+		problems = append(problems, fmt.Sprintf("target %q must be one of %s", e.Target, strings.Join(eximTargets, ", ")))
+	}
+	for _, f := range []struct {
+		name     string
+		value    string
+		max      int
+		required bool
+	}{
+		{"title", e.Title, maxEximTitleLen, true},
+		{"summary", e.Summary, maxEximSummaryLen, true},
+		{"paragraph1", e.Paragraph1, maxEximParagraphLen, true},
+		{"paragraph2", e.Paragraph2, maxEximParagraphLen, false},
+		{"paragraph3", e.Paragraph3, maxEximParagraphLen, false},
+		{"link", e.Link, maxEximLinkLen, false},
+	} {
+		n := utf8.RuneCountInString(f.value)
+		if f.required && strings.TrimSpace(f.value) == "" {
+			problems = append(problems, f.name+" is empty")
+		}
+		if n > f.max {
+			problems = append(problems, fmt.Sprintf("%s is %d characters, over the limit of %d", f.name, n, f.max))
+		}
+	}
+	if e.Link != "" {
+		if err := validateEximLink(e.Link); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// Outcome of importing one exim.
+type eximImportResult struct {
+	Row      int
+	Title    string
+	EximId   string
+	Problems []string
+}
+
+// Validates and creates each exim with the given token. Exims failing
+// validation aren't sent; in dry-run mode none are.
+func importExims(exims []eximRecord, token string) []eximImportResult {
+	var results []eximImportResult
+	for i, e := range exims {
+		fields := eximFields{
+			Target:     e.Target,
+			Title:      e.Title,
+			Summary:    e.Summary,
+			Paragraph1: e.Paragraph1,
+			Paragraph2: e.Paragraph2,
+			Paragraph3: e.Paragraph3,
+			Link:       e.Link,
+		}
+		r := eximImportResult{Row: i + 1, Title: e.Title, Problems: validateEximFields(fields)}
+		if len(r.Problems) == 0 && !dryRun {
+			r.EximId = createEximWithFields(token, fields)
+			if r.EximId == "" {
+				r.Problems = []string{"rejected by the api server"}
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Prints one line per imported exim, with the reasons for any failure.
+func printImportResults(results []eximImportResult) (created int, failed int) {
+	for _, r := range results {
+		status := "created " + r.EximId
+		switch {
+		case len(r.Problems) > 0:
+			status = "FAILED"
+			failed++
+		case r.EximId == "":
+			status = "valid (dry run)"
+		default:
+			created++
+		}
+		fmt.Printf("%4d  %-40s %s\n", r.Row, truncate(r.Title, 40), status)
+		for _, p := range r.Problems {
+			fmt.Printf("        - %s\n", p)
+		}
+	}
+	return created, failed
+}
+
+// Exports every exim the api server lists to a JSON, CSV or Markdown file.
+func runExportExims() {
+	path := promptWithDefault("Export exims to (.json, .csv or .md)", "exims.json")
+	if _, err := eximFileFormat(path); err != nil {
+		logErrorf("%v", err)
+		return
+	}
+	exims, err := fetchExims()
+	if err != nil {
+		return
+	}
+	if err := writeEximFile(path, exims); err != nil {
+		logErrorf("writing %s: %v", path, err)
+		return
+	}
+	logInfof("exported %d exims to %s", len(exims), path)
+}
+
+// Imports exims from a JSON, CSV or Markdown file, creating them as a chosen
+// test user.
+func runImportExims() {
+	path := promptLine("Import exims from (.json, .csv or .md): ")
+	exims, err := readEximFile(path)
+	if err != nil {
+		logErrorf("%v", err)
+		return
+	}
+	if len(exims) == 0 {
+		logInfof("no exims in %s", path)
+		return
+	}
+
+	store, err := loadSessionStore()
+	if err != nil {
+		logErrorf("loading sessions: %v", err)
+		return
+	}
+	printSessionUsers(store)
+	u := pickSessionUser(store, promptWithDefault("Create exims as test user", store.Active))
+	if u == nil {
+		logErrorf("no such user")
+		return
+	}
+	if u.Token == "" {
+		logErrorf("test user %s has no token - log them in first", u.Name)
+		return
+	}
+
+	results := importExims(exims, u.Token)
+	for _, r := range results {
+		if r.EximId != "" {
+			u.Exims = append(u.Exims, r.EximId)
+		}
+	}
+	saveSessionStoreOrLog(store)
+
+	created, failed := printImportResults(results)
+	var result error
+	if failed > 0 {
+		result = fmt.Errorf("%d of %d exims failed", failed, len(results))
+	}
+	if !dryRun {
+		auditAction("import exims", map[string]string{"file": path, "user": u.Name, "created": strconv.Itoa(created)}, result)
+	}
+	logInfof("imported %d of %d exims from %s as %s", created, len(results), path, u.Name)
+}
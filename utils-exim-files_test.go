@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var sampleExims = []eximRecord{
+	{
+		EximId: "01EXIM1", Author: "01USER1", IsApproved: true, Target: "CITY",
+		Title: "Fix the bridge", Summary: "It's \"falling\" down, slowly.",
+		Paragraph1: "First line\n\n- not a field\nsecond, with comma", Link: "https://example.com/bridge",
+	},
+	{
+		EximId: "01EXIM2", Author: "01USER2", Target: "FEDERAL",
+		Title: "Café hours", Summary: "日本語 summary", Paragraph1: "p1", Paragraph2: "p2", Paragraph3: "p3",
+	},
+}
+
+func TestEximFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"exims.json", "exims.csv", "exims.md"} {
+		path := filepath.Join(dir, name)
+		if err := writeEximFile(path, sampleExims); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := readEximFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, sampleExims) {
+			t.Errorf("%s: round trip = %+v\nwant %+v", name, got, sampleExims)
+		}
+	}
+	if err := writeEximFile(filepath.Join(dir, "exims.txt"), sampleExims); err == nil {
+		t.Error("expected error for unknown extension")
+	}
+}
+
+func TestReadEximFileVariants(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.json")
+	os.WriteFile(list, []byte(`[{"title":"A","target":"CITY"}]`), 0644)
+	if got, err := readEximFile(list); err != nil || len(got) != 1 || got[0].Title != "A" {
+		t.Errorf("json list = %+v, %v", got, err)
+	}
+
+	// CSV columns may be a subset in any order.
+	partial := filepath.Join(dir, "partial.csv")
+	os.WriteFile(partial, []byte("title,target\nB,STATE\n"), 0644)
+	if got, err := readEximFile(partial); err != nil || len(got) != 1 || got[0].Title != "B" || got[0].Target != "STATE" {
+		t.Errorf("partial csv = %+v, %v", got, err)
+	}
+	typo := filepath.Join(dir, "typo.csv")
+	os.WriteFile(typo, []byte("titel\nB\n"), 0644)
+	if _, err := readEximFile(typo); err == nil || !strings.Contains(err.Error(), `unknown column "titel"`) {
+		t.Errorf("typo csv err = %v", err)
+	}
+}
+
+func TestValidateEximFields(t *testing.T) {
+	valid := eximFields{Target: "CITY", Title: "t", Summary: "s", Paragraph1: "p", Link: "https://example.com"}
+	if got := validateEximFields(valid); got != nil {
+		t.Errorf("valid exim: %q", got)
+	}
+
+	invalid := valid
+	invalid.Target = "GALAXY"
+	invalid.Title = strings.Repeat("é", maxEximTitleLen+1)
+	invalid.Summary = " "
+	invalid.Link = "javascript:alert(1)"
+	want := []string{
+		`target "GALAXY" must be one of FEDERAL, STATE, COUNTY, CITY`,
+		"title is 101 characters, over the limit of 100",
+		"summary is empty",
+		`link "javascript:alert(1)" must be an http(s) url with a host`,
+	}
+	if got := validateEximFields(invalid); !reflect.DeepEqual(got, want) {
+		t.Errorf("problems = %q\nwant %q", got, want)
+	}
+
+	for _, link := range invalidLinks {
+		if validateEximLink(link) == nil {
+			t.Errorf("link %q accepted", link)
+		}
+	}
+}
+
+func TestExportImportExims(t *testing.T) {
+	f := newFakeApi(t)
+	resetTestUser(t)
+	_, token := loginNewUser(t)
+	createExim(token)
+	createExim(token)
+
+	path := filepath.Join(t.TempDir(), "exims.csv")
+	withInput(t, path)
+	captureOutput(t, runExportExims)
+	exported, err := readEximFile(path)
+	if err != nil || len(exported) != 2 || exported[0].Author == "" {
+		t.Fatalf("exported = %+v, %v", exported, err)
+	}
+
+	exported = append(exported, eximRecord{Title: "bad", Target: "CITY"})
+	if err := writeEximFile(path, exported); err != nil {
+		t.Fatal(err)
+	}
+	saveSessionStore(&sessionStore{Active: "u", Users: []*sessionUser{{Name: "u", Email: "u@email.com", Token: token}}})
+
+	withInput(t, path, "")
+	out := captureOutput(t, runImportExims)
+
+	if len(f.exims) != 4 {
+		t.Errorf("fake has %d exims, want 4:\n%s", len(f.exims), out)
+	}
+	for _, want := range []string{"   3  bad", "FAILED", "- summary is empty", "imported 2 of 3 exims"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if u := activeTestUser(t); len(u.Exims) != 2 {
+		t.Errorf("imported exims not recorded for the user: %v", u.Exims)
+	}
+}
+
+func TestImportEximsDryRun(t *testing.T) {
+	f := newFakeApi(t)
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+
+	results := importExims(sampleExims, "token")
+	if len(f.exims) != 0 {
+		t.Errorf("dry run created %d exims", len(f.exims))
+	}
+	for _, r := range results {
+		if r.EximId != "" || len(r.Problems) != 0 {
+			t.Errorf("result = %+v", r)
+		}
+	}
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A fault injected into a single fake api route. When Error is set the route
+// responds with Status and a JSON error body instead of its normal response.
+type fakeFault struct {
+	Status int
+	Error  string
+	Delay  time.Duration
+}
+
+type fakeUser struct {
+	UserId        string
+	Email         string
+	LoginCode     int
+	LoginAttempts int
+	LogoutTs      time.Time
+	IsDisabled    bool
+}
+
+type fakeExim struct {
+	EximId     string `json:"eximId"`
+	Author     string `json:"author"`
+	IsApproved bool   `json:"isApproved"`
+	Target     string `json:"target"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary"`
+	Paragraph1 string `json:"paragraph1"`
+	Paragraph2 string `json:"paragraph2"`
+	Paragraph3 string `json:"paragraph3"`
+	Link       string `json:"link"`
+}
+
+type fakeAdmin struct {
+	Email     string
+	PublicKey *rsa.PublicKey
+	Revoked   bool
+}
+
+// In-process stand-in for cp-api implementing the endpoints cp-admin uses.
+type fakeApi struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu          sync.Mutex
+	nextId      int
+	users       map[string]*fakeUser
+	emails      map[string]string
+	tokens      map[string]string
+	tokenIssued map[string]time.Time
+	exims       map[string]*fakeExim
+	eximOrder   []string
+	faults      map[string]fakeFault
+	shutdowns   int
+	adminCalls  int
+	deniedCalls int
+
+	// Registered admins by ULID, and admin calls made by each.
+	admins       map[string]*fakeAdmin
+	callsByAdmin map[string]int
+
+	// Stop listening after a shutdown request, like the real server.
+	closeOnShutdown bool
+	// Drain requested by the last shutdown call.
+	shutdownDrain string
+	// Number of /metrics scrapes; the fake's counters grow with each one.
+	scrapes int
+
+	// Raw entries added to, and keys deleted from, the buckets derived from
+	// the fake's state. Used to model inconsistent databases.
+	extraEntries map[string][]fakeBucketEntry
+	deletedKeys  map[string]map[string]bool
+	// Most entries a bucket scan returns, whatever limit is asked for; 0 for
+	// no cap.
+	scanCap int
+}
+
+// Starts a fake api server and points apiBaseUrl/apiClient at it for the
+// duration of the test.
+func newFakeApi(t *testing.T) *fakeApi {
+	t.Helper()
+	f := &fakeApi{
+		t:      t,
+		users:  make(map[string]*fakeUser),
+		emails: make(map[string]string),
+		tokens: make(map[string]string),
+		exims:  make(map[string]*fakeExim),
+		faults: make(map[string]fakeFault),
+
+		admins: map[string]*fakeAdmin{
+			testAdminUlid: {Email: "admin@email.com", PublicKey: &cpPrivateKey.PublicKey},
+		},
+		callsByAdmin: make(map[string]int),
+		tokenIssued:  make(map[string]time.Time),
+		extraEntries: make(map[string][]fakeBucketEntry),
+		deletedKeys:  make(map[string]map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user/signup/", f.route("/api/user/signup/", f.handleSignup))
+	mux.HandleFunc("/api/user/login/", f.route("/api/user/login/", f.handleLogin))
+	mux.HandleFunc("/api/user/login-code/", f.route("/api/user/login-code/", f.handleLoginCode))
+	mux.HandleFunc("/api/user/logout/", f.route("/api/user/logout/", f.handleLogout))
+	mux.HandleFunc("/api/exim/create/", f.route("/api/exim/create/", f.handleCreateExim))
+	mux.HandleFunc("/api/exim/", f.route("/api/exim/", f.handleGetExim))
+	mux.HandleFunc("/api/exims", f.route("/api/exims", f.handleGetExims))
+	mux.HandleFunc("/api/admin/", f.route("/api/admin/", f.admin(f.handleAdmin)))
+	mux.HandleFunc("/metrics", f.route("/metrics", f.handleMetrics))
+	f.server = httptest.NewServer(mux)
+
+	oldBaseUrl, oldClient := apiBaseUrl, apiClient
+	apiBaseUrl = f.server.URL
+	apiClient = instrumentClient(f.server.Client())
+	t.Cleanup(func() {
+		f.server.Close()
+		apiBaseUrl, apiClient = oldBaseUrl, oldClient
+	})
+	return f
+}
+
+// Injects a fault into the named route (the pattern it was registered with).
+func (f *fakeApi) setFault(route string, fault fakeFault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[route] = fault
+}
+
+func (f *fakeApi) newId(prefix string) string {
+	f.nextId++
+	return fmt.Sprintf("%s%0*d", prefix, 26-len(prefix), f.nextId)
+}
+
+// Wraps a handler with fault injection and state locking.
+func (f *fakeApi) route(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		fault, ok := f.faults[name]
+		f.mu.Unlock()
+		if ok {
+			time.Sleep(fault.Delay)
+			if fault.Error != "" {
+				writeFakeJSON(w, fault.Status, map[string]string{"error": fault.Error})
+				return
+			}
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		h(w, r)
+	}
+}
+
+// Rejects requests whose Admin-Authorization header is not "<ulid>.<sig>",
+// signed by the key registered for a current (unrevoked) admin.
+func (f *fakeApi) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ulid, err := f.verifyAdmin(r.Header.Get("Admin-Authorization"))
+		if err != nil {
+			f.deniedCalls++
+			writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+		f.adminCalls++
+		f.callsByAdmin[ulid]++
+		h(w, r)
+	}
+}
+
+func (f *fakeApi) verifyAdmin(token string) (string, error) {
+	ulid, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", fmt.Errorf("malformed admin token")
+	}
+	admin, ok := f.admins[ulid]
+	if !ok || admin.Revoked {
+		return "", fmt.Errorf("unknown admin")
+	}
+	signature, err := base64.URLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", fmt.Errorf("decoding signature: %v", err)
+	}
+	hashed := sha256.Sum256([]byte(ulid))
+	if err := rsa.VerifyPKCS1v15(admin.PublicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return "", fmt.Errorf("invalid signature")
+	}
+	return ulid, nil
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeApi) userFromBearer(r *http.Request) (*fakeUser, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	userId, ok := f.tokens[token]
+	if !ok {
+		return nil, false
+	}
+	return f.users[userId], true
+}
+
+func (f *fakeApi) handleSignup(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid email"})
+		return
+	}
+	if _, exists := f.emails[body.Email]; exists {
+		writeFakeJSON(w, http.StatusConflict, map[string]string{"error": "email already exists"})
+		return
+	}
+	u := &fakeUser{UserId: f.newId("01USER"), Email: body.Email}
+	f.users[u.UserId] = u
+	f.emails[u.Email] = u.UserId
+	writeFakeJSON(w, http.StatusCreated, map[string]string{"userId": u.UserId})
+}
+
+func (f *fakeApi) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, ok := f.emails[body.Email]
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "user not found"})
+		return
+	}
+	u := f.users[userId]
+	if u.IsDisabled {
+		writeFakeJSON(w, http.StatusForbidden, map[string]string{"error": "account disabled"})
+		return
+	}
+	u.LoginCode = 100000 + f.nextId
+	u.LoginAttempts = 0
+	writeFakeJSON(w, http.StatusOK, map[string]string{"userId": userId})
+}
+
+func (f *fakeApi) handleLoginCode(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserId string `json:"userId"`
+		Code   int    `json:"code"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	u, ok := f.users[body.UserId]
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]interface{}{"error": "user not found", "remainingAttempts": 0})
+		return
+	}
+	if body.Code != u.LoginCode {
+		u.LoginAttempts++
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "invalid login code", "remainingAttempts": 3 - u.LoginAttempts})
+		return
+	}
+	token := f.newId("TOKEN")
+	f.tokens[token] = u.UserId
+	f.tokenIssued[token] = time.Now().UTC()
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"token": token, "remainingAttempts": 3 - u.LoginAttempts})
+}
+
+func (f *fakeApi) handleLogout(w http.ResponseWriter, r *http.Request) {
+	u, ok := f.userFromBearer(r)
+	if !ok {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	f.revokeTokens(u.UserId)
+	u.LogoutTs = time.Now().UTC()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeApi) handleCreateExim(w http.ResponseWriter, r *http.Request) {
+	u, ok := f.userFromBearer(r)
+	if !ok {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	var e fakeExim
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid exim"})
+		return
+	}
+	e.EximId = f.newId("01EXIM")
+	e.Author = u.UserId
+	f.exims[e.EximId] = &e
+	f.eximOrder = append(f.eximOrder, e.EximId)
+	writeFakeJSON(w, http.StatusCreated, map[string]string{"eximId": e.EximId})
+}
+
+func (f *fakeApi) handleGetExim(w http.ResponseWriter, r *http.Request) {
+	e, ok := f.exims[strings.TrimPrefix(r.URL.Path, "/api/exim/")]
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "exim not found"})
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, e)
+}
+
+func (f *fakeApi) handleGetExims(w http.ResponseWriter, r *http.Request) {
+	exims := []*fakeExim{}
+	for _, id := range f.eximOrder {
+		exims = append(exims, f.exims[id])
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"exims": exims})
+}
+
+func (f *fakeApi) deleteExim(eximId string) {
+	delete(f.exims, eximId)
+	for i, id := range f.eximOrder {
+		if id == eximId {
+			f.eximOrder = append(f.eximOrder[:i], f.eximOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+type fakeBucketEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Builds the contents of cp-api's buckets from the fake's state, sorted by key.
+func (f *fakeApi) buckets() map[string][]fakeBucketEntry {
+	buckets := map[string][]fakeBucketEntry{
+		"USER_EMAIL":  {},
+		"USER_AUTH":   {},
+		"ADMIN_EMAIL": {},
+		"MOD_EXIM":    {},
+	}
+	for ulid, a := range f.admins {
+		if !a.Revoked {
+			buckets["ADMIN_EMAIL"] = append(buckets["ADMIN_EMAIL"], fakeBucketEntry{Key: []byte(ulid), Value: []byte(a.Email)})
+		}
+	}
+	for _, u := range f.users {
+		buckets["USER_EMAIL"] = append(buckets["USER_EMAIL"], fakeBucketEntry{Key: []byte(u.Email), Value: []byte(u.UserId)})
+		auth, _ := json.Marshal(map[string]interface{}{"email": u.Email, "loginCode": u.LoginCode, "loginAttempts": u.LoginAttempts, "logoutTs": u.LogoutTs})
+		buckets["USER_AUTH"] = append(buckets["USER_AUTH"], fakeBucketEntry{Key: []byte(u.UserId), Value: auth})
+	}
+	for _, e := range f.exims {
+		value, _ := json.Marshal(e)
+		buckets["MOD_EXIM"] = append(buckets["MOD_EXIM"], fakeBucketEntry{Key: []byte(e.EximId), Value: value})
+	}
+	for name, extra := range f.extraEntries {
+		buckets[name] = append(buckets[name], extra...)
+	}
+	for name, entries := range buckets {
+		kept := []fakeBucketEntry{}
+		for _, e := range entries {
+			if !f.deletedKeys[name][string(e.Key)] {
+				kept = append(kept, e)
+			}
+		}
+		sort.Slice(kept, func(i, j int) bool { return string(kept[i].Key) < string(kept[j].Key) })
+		buckets[name] = kept
+	}
+	return buckets
+}
+
+// Revokes every token belonging to userId.
+func (f *fakeApi) revokeTokens(userId string) {
+	for token, id := range f.tokens {
+		if id == userId {
+			delete(f.tokens, token)
+			delete(f.tokenIssued, token)
+		}
+	}
+}
+
+func (f *fakeApi) handleAdminUser(w http.ResponseWriter, r *http.Request, path string) {
+	idOrEmail, action, _ := strings.Cut(path, "/")
+	u, ok := f.users[idOrEmail]
+	if !ok {
+		u, ok = f.users[f.emails[idOrEmail]]
+	}
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "user not found"})
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && action == "":
+		sessions := []map[string]time.Time{}
+		eximCount := 0
+		for token, id := range f.tokens {
+			if id == u.UserId {
+				issued := f.tokenIssued[token]
+				sessions = append(sessions, map[string]time.Time{"issuedTs": issued, "expiresTs": issued.Add(24 * time.Hour)})
+			}
+		}
+		for _, e := range f.exims {
+			if e.Author == u.UserId {
+				eximCount++
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"user": map[string]interface{}{
+			"userId": u.UserId, "email": u.Email, "loginAttempts": u.LoginAttempts, "logoutTs": u.LogoutTs,
+			"isDisabled": u.IsDisabled, "sessions": sessions, "eximCount": eximCount,
+		}})
+	case r.Method == "DELETE" && action == "":
+		f.revokeTokens(u.UserId)
+		if r.URL.Query().Get("exims") == "true" {
+			for id, e := range f.exims {
+				if e.Author == u.UserId {
+					f.deleteExim(id)
+				}
+			}
+		}
+		delete(f.users, u.UserId)
+		delete(f.emails, u.Email)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && action == "reset-login-attempts":
+		u.LoginAttempts = 0
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && action == "logout":
+		f.revokeTokens(u.UserId)
+		u.LogoutTs = time.Now().UTC()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && (action == "disable" || action == "enable"):
+		u.IsDisabled = action == "disable"
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown user action"})
+	}
+}
+
+func (f *fakeApi) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/admin/")
+	switch {
+	case path == "shutdown/":
+		f.shutdowns++
+		f.shutdownDrain = r.URL.Query().Get("drain")
+		w.Write([]byte("shutting down"))
+		if f.closeOnShutdown {
+			// Close outside the handler; Close waits for in-flight requests.
+			go f.server.Close()
+		}
+	case path == "backup":
+		// Stand in for the database file with a JSON dump of the buckets.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		json.NewEncoder(w).Encode(f.buckets())
+	case strings.HasPrefix(path, "bypass-email/"):
+		u, ok := f.users[strings.TrimPrefix(path, "bypass-email/")]
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "user not found"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"loginCode": u.LoginCode, "loginAttempts": u.LoginAttempts, "logoutTs": u.LogoutTs})
+	case path == "exims":
+		exims := []*fakeExim{}
+		for _, id := range f.eximOrder {
+			e := f.exims[id]
+			if r.URL.Query().Get("approved") == "" || r.URL.Query().Get("approved") == fmt.Sprint(e.IsApproved) {
+				exims = append(exims, e)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"exims": exims})
+	case strings.HasPrefix(path, "reject-exim/"):
+		id := strings.TrimPrefix(path, "reject-exim/")
+		if _, ok := f.exims[id]; !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "exim not found"})
+			return
+		}
+		f.deleteExim(id)
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "approve-exim/"):
+		e, ok := f.exims[strings.TrimPrefix(path, "approve-exim/")]
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "exim not found"})
+			return
+		}
+		e.IsApproved = true
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "user/"):
+		f.handleAdminUser(w, r, strings.TrimPrefix(path, "user/"))
+	case path == "admins" && r.Method == "POST":
+		var body struct {
+			Email     string `json:"email"`
+			PublicKey string `json:"publicKey"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		block, _ := pem.Decode([]byte(body.PublicKey))
+		if block == nil || block.Type != "RSA PUBLIC KEY" {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid public key"})
+			return
+		}
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid public key"})
+			return
+		}
+		id := f.newId("01ADMIN")
+		f.admins[id] = &fakeAdmin{Email: body.Email, PublicKey: key}
+		writeFakeJSON(w, http.StatusCreated, map[string]string{"adminId": id})
+	case strings.HasPrefix(path, "admins/") && r.Method == "DELETE":
+		a, ok := f.admins[strings.TrimPrefix(path, "admins/")]
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "admin not found"})
+			return
+		}
+		a.Revoked = true
+		w.WriteHeader(http.StatusNoContent)
+	case path == "buckets":
+		buckets := f.buckets()
+		infos := []map[string]interface{}{}
+		for _, name := range []string{"ADMIN_EMAIL", "MOD_EXIM", "USER_AUTH", "USER_EMAIL"} {
+			infos = append(infos, map[string]interface{}{"name": name, "keyCount": len(buckets[name])})
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"buckets": infos})
+	case strings.HasPrefix(path, "bucket/"):
+		name, rest, _ := strings.Cut(strings.TrimPrefix(path, "bucket/"), "/")
+		entries, ok := f.buckets()[name]
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "bucket not found"})
+			return
+		}
+		q := r.URL.Query()
+		param := func(name string) string {
+			b, _ := base64.URLEncoding.DecodeString(q.Get(name))
+			return string(b)
+		}
+		if rest == "key" && r.Method == "DELETE" {
+			if f.deletedKeys[name] == nil {
+				f.deletedKeys[name] = make(map[string]bool)
+			}
+			f.deletedKeys[name][param("key")] = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if rest == "key" {
+			for _, e := range entries {
+				if string(e.Key) == param("key") {
+					writeFakeJSON(w, http.StatusOK, map[string]interface{}{"entry": e})
+					return
+				}
+			}
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{"error": "key not found"})
+			return
+		}
+		prefix, start, end := param("prefix"), param("start"), param("end")
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		scanned := []fakeBucketEntry{}
+		for _, e := range entries {
+			k := string(e.Key)
+			if !strings.HasPrefix(k, prefix) || k < start || (end != "" && k > end) {
+				continue
+			}
+			if (limit > 0 && len(scanned) == limit) || (f.scanCap > 0 && len(scanned) == f.scanCap) {
+				break
+			}
+			scanned = append(scanned, e)
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"bucket": name, "entries": scanned})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Serves Prometheus text metrics whose counters advance by a fixed amount per
+// scrape: 10 signups (one a 500) and 5 logins, all observed under 0.1s.
+func (f *fakeApi) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	f.scrapes++
+	n := f.scrapes
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, `# TYPE http_requests_total counter
+http_requests_total{route="/api/user/signup/",code="201"} %d
+http_requests_total{route="/api/user/signup/",code="500"} %d
+http_requests_total{route="/api/user/login/",code="200"} %d
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="/api/user/signup/",le="0.05"} %d
+http_request_duration_seconds_bucket{route="/api/user/signup/",le="0.1"} %d
+http_request_duration_seconds_bucket{route="/api/user/signup/",le="+Inf"} %d
+http_request_duration_seconds_sum{route="/api/user/signup/"} %f
+http_request_duration_seconds_count{route="/api/user/signup/"} %d
+# TYPE go_goroutines gauge
+go_goroutines %d
+# TYPE process_resident_memory_bytes gauge
+process_resident_memory_bytes %d
+`, 9*n, n, 5*n, 5*n, 10*n, 10*n, 0.5*float64(n), 10*n, 10+n, 64<<20)
+}
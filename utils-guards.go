@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// When set, mutating Hetzner and API calls are printed instead of made.
+var dryRun bool
+
+// Returned by calls skipped in dry-run mode, so callers don't mistake the
+// skip for success.
+var errDryRun = errors.New("skipped in dry-run mode")
+
+// Returns true, after printing the call that would have been made, when
+// dry-run mode is on. Callers return early on true.
+func dryRunSkip(format string, args ...interface{}) bool {
+	if !dryRun {
+		return false
+	}
+	logger.Info("dry-run: would "+fmt.Sprintf(format, args...), "dry_run", true)
+	return true
+}
+
+// Asks the user to type target to confirm a destructive action. In the
+// production profile the profile name must be typed as well. Confirmation is
+// skipped in dry-run mode, where nothing is changed.
+func confirmDestructive(action string, target string) bool {
+	return confirmDestructiveOn(action, activeProfile, target)
+}
+
+// Like confirmDestructive, for an action against env (a profile name or base
+// URL) other than the active profile.
+func confirmDestructiveOn(action string, env string, target string) bool {
+	if dryRun {
+		return true
+	}
+	input := promptLine(fmt.Sprintf("About to %s on %s. Type %q to confirm: ", action, env, target))
+	if input == target && env == "production" {
+		input = promptLine("This is PRODUCTION. Type \"production\" to proceed: ")
+		if input == "production" {
+			return true
+		}
+	} else if input == target {
+		return true
+	}
+	logInfof("%s cancelled", action)
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+// Sets the active profile and dry-run mode for the duration of the test.
+func withGuards(t *testing.T, profile string, dry bool) {
+	t.Helper()
+	oldProfile, oldDryRun := activeProfile, dryRun
+	activeProfile, dryRun = profile, dry
+	t.Cleanup(func() { activeProfile, dryRun = oldProfile, oldDryRun })
+}
+
+func TestConfirmDestructive(t *testing.T) {
+	withGuards(t, "local", false)
+	withInput(t, "cp-1", "y", "cp-1")
+	if !confirmDestructive("delete server cp-1", "cp-1") {
+		t.Error("typed target was not accepted")
+	}
+	if confirmDestructive("delete server cp-1", "cp-1") {
+		t.Error("y was accepted in place of the target")
+	}
+
+	// Production also requires typing the profile name.
+	withGuards(t, "production", false)
+	withInput(t, "cp-1", "yes", "cp-1", "production")
+	if confirmDestructive("delete server cp-1", "cp-1") {
+		t.Error("production confirmation accepted without the profile name")
+	}
+	if !confirmDestructive("delete server cp-1", "cp-1") {
+		t.Error("production confirmation rejected")
+	}
+}
+
+func TestDryRunSkipsMutatingCalls(t *testing.T) {
+	f := newFakeApi(t)
+	withAuditLog(t)
+	_, token := loginNewUser(t)
+	eximId := createExim(token)
+	withGuards(t, "local", true)
+
+	if err := approveExim(eximId); err != errDryRun {
+		t.Errorf("approveExim = %v, want errDryRun", err)
+	}
+	shutdown()
+	// Reads still go through so dry runs can show what they would act on.
+	if exims, err := getUnapprovedExims(); err != nil || len(exims) != 1 {
+		t.Errorf("getUnapprovedExims = %d exims, err %v", len(exims), err)
+	}
+
+	if f.exims[eximId].IsApproved || f.shutdowns != 0 || f.adminCalls != 2 {
+		t.Errorf("dry run reached the api: approved %v, shutdowns %d, admin calls %d", f.exims[eximId].IsApproved, f.shutdowns, f.adminCalls)
+	}
+	if records, _ := readAuditLog(); len(records) != 0 {
+		t.Errorf("dry run was audited: %+v", records)
+	}
+}
+
+func TestDryRunSkipsUserCalls(t *testing.T) {
+	f := newFakeApi(t)
+	withAuditLog(t)
+	_, token := loginNewUser(t)
+	withGuards(t, "local", true)
+
+	if _, err := signup("new@email.com"); err != errDryRun {
+		t.Errorf("signup = %v, want errDryRun", err)
+	}
+	if _, err := login("new@email.com"); err != errDryRun {
+		t.Errorf("login = %v, want errDryRun", err)
+	}
+	if _, _, err := loginCode("01USER", 123456); err != errDryRun {
+		t.Errorf("loginCode = %v, want errDryRun", err)
+	}
+	if eximId := createExim(token); eximId != "" {
+		t.Errorf("createExim = %q in dry-run mode", eximId)
+	}
+	if err := logout(token, "01USER"); err != errDryRun {
+		t.Errorf("logout = %v, want errDryRun", err)
+	}
+	withInput(t, "1", "1", "1")
+	runSeedDatabase()
+	withInput(t, "1", "1", "1s", "0s")
+	runLoadTest()
+
+	if len(f.users) != 1 || len(f.exims) != 0 || len(f.tokens) != 1 {
+		t.Errorf("dry run reached the api: %d users, %d exims, %d tokens", len(f.users), len(f.exims), len(f.tokens))
+	}
+}
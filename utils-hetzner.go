@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"gopkg.in/yaml.v3"
@@ -54,33 +55,33 @@ func hetznerGetAndSetCurrentResources() {
 	// SSH Key(s)
 	sshKeys, err := hcloudClient.SSHKey.All(context.TODO())
 	if err != nil {
-		fmt.Printf("[err][admin] retrieving ssh key(s): %s [%s]\n", err, cts())
+		logErrorf("retrieving ssh key(s): %s", err)
 		os.Exit(1)
 		return
 	}
 
 	// If sshKeys is empty, print message and return.
 	if len(sshKeys) == 0 {
-		fmt.Printf("[admin] no servers found [%s]\n", cts())
+		logInfof("no servers found")
 		return
 	}
 
 	// Print all servers.
 	for _, key := range sshKeys {
-		fmt.Printf("[admin] ssh key ID: %d, name: %s [%s]\n", key.ID, key.Name, cts())
+		logInfof("ssh key ID: %d, name: %s", key.ID, key.Name)
 	}
 
 	// Servers
 	servers, err := hcloudClient.Server.All(context.TODO())
 	if err != nil {
-		fmt.Printf("[err][admin] retrieving servers: %s [%s]\n", err, cts())
+		logErrorf("retrieving servers: %s", err)
 		os.Exit(1)
 		return
 	}
 
 	// If servers is empty, print message and return.
 	if len(servers) == 0 {
-		fmt.Printf("[admin] no servers found [%s]\n", cts())
+		logInfof("no servers found")
 		return
 	}
 
@@ -91,7 +92,7 @@ func hetznerGetAndSetCurrentResources() {
 
 	// Print all servers.
 	for _, server := range serverMap {
-		fmt.Printf("[admin] server ID: %d, ip: %s, name: %s, status: %s [%s]\n", server.ID, server.PublicNet.IPv4.IP, server.Name, server.Status, cts())
+		logInfof("server ID: %d, ip: %s, name: %s, status: %s", server.ID, server.PublicNet.IPv4.IP, server.Name, server.Status)
 	}
 }
 
@@ -100,7 +101,7 @@ func hetznerCreateSSHKey() {
 	pubKeyPath := os.Getenv("LOCAL_PUBLIC_KEY_PATH")
 	pubKey, err := os.ReadFile(pubKeyPath)
 	if err != nil {
-		fmt.Printf("[err][admin] reading local public key file at: %s: %v [%s]\n", pubKeyPath, err, cts())
+		logErrorf("reading local public key file at: %s: %v", pubKeyPath, err)
 		os.Exit(1)
 	}
 
@@ -110,15 +111,20 @@ func hetznerCreateSSHKey() {
 		PublicKey: string(pubKey),
 	}
 
+	if dryRunSkip("call hcloud SSHKey.Create name=%s", opts.Name) {
+		return
+	}
+
 	// Create SSH key.
 	sshKey, _, err := hcloudClient.SSHKey.Create(context.TODO(), opts)
+	auditAction("hetzner create ssh key", map[string]string{"name": opts.Name}, err)
 	if err != nil {
-		fmt.Printf("[err][admin] creating SSH key: %v [%s]\n", err, cts())
+		logErrorf("creating SSH key: %v", err)
 		return
 	}
 
 	// Print the ID of the created SSH key.
-	fmt.Printf("[admin] created SSH key with ID: %v [%s]", sshKey.ID, cts())
+	logInfof("created SSH key with ID: %v", sshKey.ID)
 }
 
 // Creates a yaml formatted string of "user data" for cloud-init.
@@ -126,7 +132,7 @@ func createUserData() string {
 	pubKeyPath := os.Getenv("LOCAL_PUBLIC_KEY_PATH")
 	pubKey, err := os.ReadFile(pubKeyPath)
 	if err != nil {
-		fmt.Printf("[err][admin] reading local public key file at: %s: %v [%s]\n", pubKeyPath, err, cts())
+		logErrorf("reading local public key file at: %s: %v", pubKeyPath, err)
 		os.Exit(1)
 	}
 
@@ -212,7 +218,7 @@ cooperativeparty.org {
 
 	data, err := yaml.Marshal(&userData)
 	if err != nil {
-		fmt.Printf("[err][admin] marshaling userData to yaml: %v [%s]\n", err, cts())
+		logErrorf("marshaling userData to yaml: %v", err)
 	}
 	// Add comment for cloud-init to recognize this file as cloud-config.
 	return "#cloud-config\n" + string(data)
@@ -223,10 +229,10 @@ func writeUserDataToFile() {
 	userData := createUserData()
 	err := os.WriteFile("user_data_test.yml", []byte(userData), 0644)
 	if err != nil {
-		fmt.Printf("[err][admin] writing user data to file: %v [%s]\n", err, cts())
+		logErrorf("writing user data to file: %v", err)
 		os.Exit(1)
 	}
-	fmt.Printf("[admin] user data successfully written to file [%s]\n", cts())
+	logInfof("user data successfully written to file")
 }
 
 // Create a Hetzner cloud server instance with the name "cp-1".
@@ -234,7 +240,7 @@ func hetznerCreateServerOne() {
 	// Get the SSH key by name.
 	sshKey, _, err := hcloudClient.SSHKey.Get(context.TODO(), os.Getenv("HETZNER_PUBLIC_KEY_NAME"))
 	if err != nil {
-		fmt.Printf("[err][admin] getting SSH key: %v [%s]\n", err, cts())
+		logErrorf("getting SSH key: %v", err)
 		return
 	}
 
@@ -248,33 +254,56 @@ func hetznerCreateServerOne() {
 		UserData:   createUserData(),
 	}
 
+	if dryRunSkip("call hcloud Server.Create name=%s type=%s image=%s location=%s ssh-key=%s", opts.Name, opts.ServerType.Name, opts.Image.Name, opts.Location.Name, sshKey.Name) {
+		return
+	}
+
 	// Create server.
 	result, _, err := hcloudClient.Server.Create(context.TODO(), opts)
+	var actionIds []int64
+	if err == nil {
+		actionIds = append(actionIds, result.Action.ID)
+		for _, action := range result.NextActions {
+			actionIds = append(actionIds, action.ID)
+		}
+	}
+	auditAction("hetzner create server", map[string]string{"name": opts.Name, "type": opts.ServerType.Name, "image": opts.Image.Name, "location": opts.Location.Name}, err, actionIds...)
 	if err != nil {
-		fmt.Printf("[err][admin] creating server: %v [%s]\n", err, cts())
+		logErrorf("creating server: %v", err)
 		os.Exit(1)
 	}
 
 	// Print the ID of the created server
-	fmt.Printf("[admin] created server with ID: %v, and IP: %v [%s]\n", result.Server.ID, result.Server.PublicNet.IPv4.IP, cts())
+	logInfof("created server with ID: %v, and IP: %v", result.Server.ID, result.Server.PublicNet.IPv4.IP)
 }
 
 // Delete Hetzner cloud server instance that has the name "cp-1".
 func hetznerDeleteServerOne() {
 	server, ok := serverMap["cp-1"]
 	if !ok {
-		fmt.Printf("[err][admin] server with name \"cp-1\" not found locally... run Get/Set Current Resources command[%s]\n", cts())
+		logErrorf("server with name \"cp-1\" not found locally... run Get/Set Current Resources command")
+		return
+	}
+	if !confirmDestructive("delete server cp-1", "cp-1") {
+		return
+	}
+	if dryRunSkip("call hcloud Server.DeleteWithResult id=%d name=%s, then ssh-keygen -R %s", server.ID, server.Name, server.PublicNet.IPv4.IP) {
 		return
 	}
 
-	_, _, err := hcloudClient.Server.DeleteWithResult(context.TODO(), server)
+	result, _, err := hcloudClient.Server.DeleteWithResult(context.TODO(), server)
+	var actionIds []int64
+	if err == nil && result.Action != nil {
+		actionIds = append(actionIds, result.Action.ID)
+	}
+	auditAction("hetzner delete server", map[string]string{"name": server.Name, "id": strconv.FormatInt(server.ID, 10)}, err, actionIds...)
 	if err != nil {
-		fmt.Printf("[err][admin] deleting server: %v [%s]\n", err, cts())
+		logErrorf("deleting server: %v", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("[admin] deleted server cp-1 [%s]\n", cts())
-	fmt.Printf("[admin] removing known host... [%s]\n", cts())
+	logInfof("deleted server cp-1")
+	logInfof("removing known host...")
 
 	// Remove cp-1 IP address from ssh known hosts.
 	goGetCmd := exec.Command("ssh-keygen", "-R", server.PublicNet.IPv4.IP.String())
@@ -284,7 +313,7 @@ func hetznerDeleteServerOne() {
 	// Run command and wait for it to complete.
 	err = goGetCmd.Run()
 	if err != nil {
-		fmt.Printf("[err][admin] running ssh-keygen -R command: %v [%s]\n", err, cts())
+		logErrorf("running ssh-keygen -R command: %v", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Order in which endpoints are exercised (and reported) by each virtual user.
+var loadEndpoints = []string{"signup", "login", "bypass-email", "login-code", "create-exim", "logout"}
+
+type loadConfig struct {
+	users      int
+	iterations int
+	duration   time.Duration
+	rampUp     time.Duration
+}
+
+// Latency samples kept per endpoint. Long runs keep a uniform random sample
+// of this size rather than every latency, so memory stays bounded.
+const loadSampleSize = 10000
+
+// Latencies and outcomes recorded for a single endpoint.
+type endpointStats struct {
+	requests  int
+	errors    int
+	max       time.Duration
+	latencies []time.Duration // reservoir sample of at most loadSampleSize
+}
+
+type loadStats struct {
+	mu        sync.Mutex
+	rng       *rand.Rand
+	endpoints map[string]*endpointStats
+	sequences int
+	failed    int
+	elapsed   time.Duration
+}
+
+func newLoadStats() *loadStats {
+	stats := &loadStats{endpoints: make(map[string]*endpointStats), rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	for _, name := range loadEndpoints {
+		stats.endpoints[name] = &endpointStats{}
+	}
+	return stats
+}
+
+func (s *loadStats) record(endpoint string, latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	es := s.endpoints[endpoint]
+	es.requests++
+	if latency > es.max {
+		es.max = latency
+	}
+	if len(es.latencies) < loadSampleSize {
+		es.latencies = append(es.latencies, latency)
+	} else if i := s.rng.Intn(es.requests); i < loadSampleSize {
+		es.latencies[i] = latency
+	}
+	if failed {
+		es.errors++
+	}
+}
+
+func (s *loadStats) recordSequence(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sequences++
+	if err != nil {
+		s.failed++
+	}
+}
+
+// Returns the p-th percentile (0-100) of sorted latencies, using nearest rank.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// Sends a request on behalf of a virtual user, timing it and recording the
+// result under endpoint. Unlike the interactive commands, failures are
+// returned rather than exiting so a single bad response doesn't end the run.
+func loadRequest(stats *loadStats, endpoint string, req *http.Request, dst interface{}) error {
+	start := time.Now()
+	res, err := apiClient.Do(req)
+	if err != nil {
+		stats.record(endpoint, time.Since(start), true)
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	latency := time.Since(start)
+	if err != nil {
+		stats.record(endpoint, latency, true)
+		return err
+	}
+
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(body, &apiErr)
+	if res.StatusCode >= 400 || apiErr.Error != "" {
+		stats.record(endpoint, latency, true)
+		return fmt.Errorf("%s returned %d: %s", endpoint, res.StatusCode, apiErr.Error)
+	}
+	if dst != nil {
+		if err := json.Unmarshal(body, dst); err != nil {
+			stats.record(endpoint, latency, true)
+			return err
+		}
+	}
+	stats.record(endpoint, latency, false)
+	return nil
+}
+
+func newLoadJSONRequest(method string, path string, body interface{}) *http.Request {
+	var buf io.Reader
+	if body != nil {
+		jsonData, _ := json.Marshal(body)
+		buf = bytes.NewBuffer(jsonData)
+	}
+	req, _ := http.NewRequest(method, apiBaseUrl+path, buf)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// Runs signup, login, login-code (via admin bypass), create-exim and logout
+// for a fresh user, stopping at the first failure.
+func runLoadSequence(stats *loadStats, vu int, iteration int) error {
+	email := fmt.Sprintf("vu%d-%d-%s", vu, iteration, generateRandomEmailAddress())
+
+	var signupRes struct {
+		UserId string `json:"userId"`
+	}
+	req := newLoadJSONRequest("POST", "/api/user/signup/", map[string]string{"email": email})
+	if err := loadRequest(stats, "signup", req, &signupRes); err != nil {
+		return err
+	}
+
+	var loginRes struct {
+		UserId string `json:"userId"`
+	}
+	req = newLoadJSONRequest("POST", "/api/user/login/", map[string]string{"email": email})
+	if err := loadRequest(stats, "login", req, &loginRes); err != nil {
+		return err
+	}
+
+	var bypassRes struct {
+		LoginCode int `json:"loginCode"`
+	}
+	req = newLoadJSONRequest("GET", "/api/admin/bypass-email/"+loginRes.UserId, nil)
+	req.Header.Set("Admin-Authorization", adminAuthToken)
+	if err := loadRequest(stats, "bypass-email", req, &bypassRes); err != nil {
+		return err
+	}
+
+	var loginCodeRes struct {
+		Token string `json:"token"`
+	}
+	req = newLoadJSONRequest("POST", "/api/user/login-code/", map[string]interface{}{"userId": loginRes.UserId, "code": bypassRes.LoginCode})
+	if err := loadRequest(stats, "login-code", req, &loginCodeRes); err != nil {
+		return err
+	}
+
+	exim := generateEximFields(eximDataTypical)
+	req = newLoadJSONRequest("POST", "/api/exim/create/", exim)
+	req.Header.Set("Authorization", "Bearer "+loginCodeRes.Token)
+	if err := loadRequest(stats, "create-exim", req, nil); err != nil {
+		return err
+	}
+
+	req = newLoadJSONRequest("POST", "/api/user/logout/", map[string]string{"userId": loginRes.UserId})
+	req.Header.Set("Authorization", "Bearer "+loginCodeRes.Token)
+	return loadRequest(stats, "logout", req, nil)
+}
+
+// Runs cfg.users virtual users concurrently, each repeating the load sequence
+// until it has completed cfg.iterations (if non-zero) or cfg.duration elapses.
+// Virtual users are started evenly across the ramp-up period.
+func runLoad(cfg loadConfig) *loadStats {
+	stats := newLoadStats()
+	start := time.Now()
+	var deadline time.Time
+	if cfg.duration > 0 {
+		deadline = start.Add(cfg.rampUp + cfg.duration)
+	}
+
+	var wg sync.WaitGroup
+	for vu := 0; vu < cfg.users; vu++ {
+		wg.Add(1)
+		delay := time.Duration(0)
+		if cfg.users > 1 {
+			delay = cfg.rampUp * time.Duration(vu) / time.Duration(cfg.users)
+		}
+		go func(vu int, delay time.Duration) {
+			defer wg.Done()
+			time.Sleep(delay)
+			for i := 0; cfg.iterations == 0 || i < cfg.iterations; i++ {
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					return
+				}
+				stats.recordSequence(runLoadSequence(stats, vu, i))
+			}
+		}(vu, delay)
+	}
+	wg.Wait()
+	stats.elapsed = time.Since(start)
+	return stats
+}
+
+func printLoadReport(stats *loadStats) {
+	total := 0
+	logInfof("load test finished in %s: %d sequences, %d failed", stats.elapsed.Round(time.Millisecond), stats.sequences, stats.failed)
+	fmt.Printf("%-14s %8s %8s %8s %10s %10s %10s %10s\n", "ENDPOINT", "REQS", "ERRORS", "ERR %", "P50", "P90", "P99", "MAX")
+	for _, name := range loadEndpoints {
+		es := stats.endpoints[name]
+		n := es.requests
+		total += n
+		sorted := append([]time.Duration(nil), es.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		errRate := 0.0
+		if n > 0 {
+			errRate = float64(es.errors) / float64(n) * 100
+		}
+		fmt.Printf("%-14s %8d %8d %8.1f %10s %10s %10s %10s\n", name, n, es.errors, errRate,
+			percentile(sorted, 50).Round(time.Microsecond),
+			percentile(sorted, 90).Round(time.Microsecond),
+			percentile(sorted, 99).Round(time.Microsecond),
+			es.max.Round(time.Microsecond))
+	}
+	if stats.elapsed > 0 {
+		logInfof("throughput: %.1f req/s, %.2f sequences/s", float64(total)/stats.elapsed.Seconds(), float64(stats.sequences)/stats.elapsed.Seconds())
+	}
+}
+
+// Prompts for load parameters and runs a load test against the API server.
+func runLoadTest() {
+	users, err := strconv.Atoi(promptWithDefault("Virtual users", "10"))
+	if err != nil || users < 1 {
+		logErrorf("virtual users must be a positive integer")
+		return
+	}
+	iterations, err := strconv.Atoi(promptWithDefault("Iterations per user (0 = use duration)", "0"))
+	if err != nil || iterations < 0 {
+		logErrorf("iterations must be a non-negative integer")
+		return
+	}
+	duration, err := time.ParseDuration(promptWithDefault("Duration", "30s"))
+	if err != nil {
+		logErrorf("parsing duration: %v", err)
+		return
+	}
+	if iterations == 0 && duration <= 0 {
+		logErrorf("duration must be positive when iterations is 0")
+		return
+	}
+	if iterations > 0 {
+		duration = 0
+	}
+	rampUp, err := time.ParseDuration(promptWithDefault("Ramp-up", "5s"))
+	if err != nil {
+		logErrorf("parsing ramp-up: %v", err)
+		return
+	}
+
+	if dryRunSkip("run a load test with %d virtual users", users) {
+		return
+	}
+	logInfof("starting load test with %d virtual users", users)
+	stats := runLoad(loadConfig{users: users, iterations: iterations, duration: duration, rampUp: rampUp})
+	printLoadReport(stats)
+}
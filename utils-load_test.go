@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	cases := map[float64]time.Duration{0: 1, 50: 5, 90: 9, 99: 10, 100: 10}
+	for p, want := range cases {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of empty = %v, want 0", got)
+	}
+}
+
+func TestLoadStatsBoundsSamples(t *testing.T) {
+	stats := newLoadStats()
+	for i := 1; i <= 3*loadSampleSize; i++ {
+		stats.record("signup", time.Duration(i), false)
+	}
+	es := stats.endpoints["signup"]
+	if es.requests != 3*loadSampleSize || len(es.latencies) != loadSampleSize {
+		t.Errorf("requests = %d, samples = %d; want %d, %d", es.requests, len(es.latencies), 3*loadSampleSize, loadSampleSize)
+	}
+	if es.max != time.Duration(3*loadSampleSize) {
+		t.Errorf("max = %v, want %v", es.max, time.Duration(3*loadSampleSize))
+	}
+}
+
+func TestRunLoadIterations(t *testing.T) {
+	f := newFakeApi(t)
+	stats := runLoad(loadConfig{users: 3, iterations: 2, rampUp: 10 * time.Millisecond})
+	if stats.sequences != 6 || stats.failed != 0 {
+		t.Fatalf("sequences = %d, failed = %d; want 6, 0", stats.sequences, stats.failed)
+	}
+	for _, name := range loadEndpoints {
+		if n := stats.endpoints[name].requests; n != 6 {
+			t.Errorf("%s requests = %d, want 6", name, n)
+		}
+	}
+	if len(f.users) != 6 || len(f.exims) != 6 {
+		t.Errorf("fake has %d users and %d exims, want 6 and 6", len(f.users), len(f.exims))
+	}
+	printLoadReport(stats)
+}
+
+func TestRunLoadRecordsErrors(t *testing.T) {
+	f := newFakeApi(t)
+	f.setFault("/api/exim/create/", fakeFault{Status: http.StatusTooManyRequests, Error: "slow down"})
+	stats := runLoad(loadConfig{users: 2, iterations: 1})
+	if stats.failed != 2 {
+		t.Errorf("failed sequences = %d, want 2", stats.failed)
+	}
+	if es := stats.endpoints["create-exim"]; es.errors != 2 {
+		t.Errorf("create-exim errors = %d, want 2", es.errors)
+	}
+	// Sequences stop at the first failure.
+	if n := stats.endpoints["logout"].requests; n != 0 {
+		t.Errorf("logout requests = %d, want 0", n)
+	}
+}
+
+func TestRunLoadDuration(t *testing.T) {
+	newFakeApi(t)
+	stats := runLoad(loadConfig{users: 2, duration: 50 * time.Millisecond})
+	if stats.sequences == 0 {
+		t.Error("expected at least one sequence within duration")
+	}
+	if stats.elapsed > time.Second {
+		t.Errorf("elapsed = %v, expected run to stop near duration", stats.elapsed)
+	}
+}
+
+func TestRunLoadTestRejectsUnboundedRun(t *testing.T) {
+	f := newFakeApi(t)
+	withInput(t, "2", "0", "0s")
+	out := captureOutput(t, runLoadTest)
+	if !strings.Contains(out, "duration must be positive") || len(f.users) != 0 {
+		t.Errorf("unbounded run not rejected:\n%s", out)
+	}
+}
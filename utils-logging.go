@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum level logged, set from -log-level. At debug, full HTTP requests
+// and responses are dumped with secrets redacted.
+var logLevel = new(slog.LevelVar)
+
+// Logger used for all of cp-admin's messages. Commands run with a logger
+// carrying the command name; see withCommandLogger.
+var logger = slog.New(newConsoleHandler(logLevel))
+
+// Writes to whatever os.Stdout is at the time, so tests capturing stdout see
+// log output too.
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+// Handler writing one human-readable line per record:
+//
+//	2024-01-31T10:00:00+01:00 INFO  created server name=cp-1 env=local
+type consoleHandler struct {
+	level slog.Leveler
+	attrs []slog.Attr
+	mu    *sync.Mutex
+}
+
+func newConsoleHandler(level slog.Leveler) *consoleHandler {
+	return &consoleHandler{level: level, mu: &sync.Mutex{}}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &h2
+}
+
+// Groups aren't used by cp-admin; attributes are written unqualified.
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %-5s %s", r.Time.Format(time.RFC3339), r.Level, r.Message)
+	// Multi-line values such as HTTP dumps follow the line, unquoted.
+	var blocks []string
+	writeAttr := func(a slog.Attr) bool {
+		v := a.Value.Resolve().String()
+		if strings.Contains(v, "\n") {
+			blocks = append(blocks, strings.TrimRight(v, "\r\n"))
+			return true
+		}
+		if v == "" || strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", a.Key, v)
+		return true
+	}
+	r.Attrs(writeAttr)
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	b.WriteByte('\n')
+	for _, block := range blocks {
+		b.WriteString(block)
+		b.WriteByte('\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := os.Stdout.Write(b.Bytes())
+	return err
+}
+
+// Configures logger from the -log-format ("console" or "json") and
+// -log-level ("debug", "info", "warn" or "error") flags.
+func setLogger(format string, level string) error {
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	switch format {
+	case "console":
+		logger = slog.New(newConsoleHandler(logLevel))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(stdoutWriter{}, &slog.HandlerOptions{Level: logLevel}))
+	default:
+		return fmt.Errorf("invalid log format %q (want console or json)", format)
+	}
+	return nil
+}
+
+// Runs fn with logger tagged with the command being run.
+func withCommandLogger(command string, fn func()) {
+	base := logger
+	logger = logger.With("command", command)
+	defer func() { logger = base }()
+	fn()
+}
+
+func logDebugf(format string, args ...interface{}) {
+	logger.Debug(fmt.Sprintf(format, args...))
+}
+
+func logInfof(format string, args ...interface{}) {
+	logger.Info(fmt.Sprintf(format, args...))
+}
+
+func logWarnf(format string, args ...interface{}) {
+	logger.Warn(fmt.Sprintf(format, args...))
+}
+
+func logErrorf(format string, args ...interface{}) {
+	logger.Error(fmt.Sprintf(format, args...))
+}
+
+// Headers and JSON fields whose values never appear in debug dumps. Fields
+// match by key (e.g. "token", "sessionToken", "code", "loginCode") whether
+// the value is a string or a number.
+var redactedHeaders = []string{"Admin-Authorization", "Authorization", "Cookie", "Set-Cookie"}
+var redactedFieldPattern = regexp.MustCompile(`(?i)("(?:[a-z]*token|password|[a-z]*code|privatekey|publickey)"\s*:\s*)(?:"(?:[^"\\]|\\.)*"|-?[0-9][0-9.eE+-]*)`)
+
+const redacted = "REDACTED"
+
+// Replaces the values of secret fields in a JSON body.
+func redactFields(body []byte) []byte {
+	return redactedFieldPattern.ReplaceAll(body, []byte(`${1}"`+redacted+`"`))
+}
+
+// Replaces secrets in a dumped HTTP request or response.
+func redactDump(dump []byte) []byte {
+	lines := bytes.Split(dump, []byte("\r\n"))
+	for i, line := range lines {
+		for _, h := range redactedHeaders {
+			if len(line) > len(h) && strings.EqualFold(string(line[:len(h)+1]), h+":") {
+				lines[i] = []byte(h + ": " + redacted)
+			}
+		}
+	}
+	return redactFields(bytes.Join(lines, []byte("\r\n")))
+}
+
+// Header carrying the ID cp-admin assigns each API request, so its log lines
+// can be matched with cp-api's.
+const requestIdHeader = "X-Request-Id"
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	cryptoRand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Logs the status of a cp-api response along with the ID of the request it
+// answers, for matching with cp-api's logs.
+func logResponse(res *http.Response) {
+	attrs := []interface{}{"status", res.StatusCode}
+	if req := res.Request; req != nil {
+		attrs = append(attrs, "method", req.Method, "path", req.URL.Path, "request_id", req.Header.Get(requestIdHeader))
+	}
+	logger.Info("response "+res.Status, attrs...)
+}
+
+// RoundTripper logging each request with an ID, its status and duration, and
+// at debug level dumping it and its response.
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	requestId := newRequestId()
+	req.Header.Set(requestIdHeader, requestId)
+	debug := logger.Enabled(req.Context(), slog.LevelDebug)
+	if debug {
+		if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+			logger.Debug("api request dump", "request_id", requestId, "dump", string(redactDump(dump)))
+		}
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		logger.Warn("api request failed", "request_id", requestId, "method", req.Method, "path", req.URL.Path, "error", err)
+		return res, err
+	}
+	logger.Debug("api request", "request_id", requestId, "method", req.Method, "path", req.URL.Path, "status", res.StatusCode, "duration", time.Since(start).Round(time.Millisecond))
+	if debug {
+		if dump, err := httputil.DumpResponse(res, true); err == nil {
+			logger.Debug("api response dump", "request_id", requestId, "dump", string(redactDump(dump)))
+		}
+	}
+	return res, err
+}
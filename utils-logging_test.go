@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Swaps in a logger configured by setLogger for the duration of a test.
+func withLogger(t *testing.T, format string, level string) {
+	t.Helper()
+	oldLogger, oldLevel := logger, logLevel.Level()
+	t.Cleanup(func() { logger = oldLogger; logLevel.Set(oldLevel) })
+	if err := setLogger(format, level); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsoleLogger(t *testing.T) {
+	withLogger(t, "console", "info")
+	out := captureOutput(t, func() {
+		withCommandLogger("Create Exim", func() {
+			logInfof("created exim %s", "abc")
+			logDebugf("not shown")
+		})
+		logErrorf("after command")
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines:\n%s", len(lines), out)
+	}
+	want := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(Z|[+-]\d\d:\d\d) INFO  created exim abc command="Create Exim"$`)
+	if !want.MatchString(lines[0]) {
+		t.Errorf("line = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], " ERROR after command") || strings.Contains(lines[1], "command=") {
+		t.Errorf("line = %q", lines[1])
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	withLogger(t, "json", "warn")
+	out := captureOutput(t, func() {
+		logger = logger.With("env", "production")
+		logInfof("not shown")
+		logWarnf("api server returned error: %s", "nope")
+	})
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &record); err != nil {
+		t.Fatalf("%v: %q", err, out)
+	}
+	if record["level"] != "WARN" || record["msg"] != "api server returned error: nope" || record["env"] != "production" {
+		t.Errorf("record = %v", record)
+	}
+}
+
+func TestLogResponse(t *testing.T) {
+	withLogger(t, "json", "info")
+	req, _ := http.NewRequest("POST", "http://localhost:8000/api/exim/create/", nil)
+	req.Header.Set(requestIdHeader, "req-1")
+	out := captureOutput(t, func() {
+		logResponse(&http.Response{Status: "201 Created", StatusCode: 201, Request: req})
+	})
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &record); err != nil {
+		t.Fatalf("%v: %q", err, out)
+	}
+	if record["level"] != "INFO" || record["status"] != float64(201) || record["request_id"] != "req-1" ||
+		record["method"] != "POST" || record["path"] != "/api/exim/create/" {
+		t.Errorf("record = %v", record)
+	}
+}
+
+func TestSetLoggerInvalid(t *testing.T) {
+	withLogger(t, "console", "info")
+	if setLogger("xml", "info") == nil {
+		t.Error("accepted format xml")
+	}
+	if setLogger("json", "loud") == nil {
+		t.Error("accepted level loud")
+	}
+}
+
+func TestRedactDump(t *testing.T) {
+	dump := "POST /api/user/login-code/ HTTP/1.1\r\nAdmin-Authorization: secret-sig\r\nauthorization: Bearer secret-token\r\nContent-Type: application/json\r\n\r\n" +
+		`{"email":"a@b.c","code":"123456","sessionToken": "secret-session"}`
+	got := string(redactDump([]byte(dump)))
+	for _, secret := range []string{"secret-sig", "secret-token", "123456", "secret-session"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("dump still contains %q:\n%s", secret, got)
+		}
+	}
+	for _, kept := range []string{"Content-Type: application/json", `"email":"a@b.c"`, `"code":"REDACTED"`} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("dump missing %q:\n%s", kept, got)
+		}
+	}
+}
+
+// Bodies as cp-api exchanges them during login.
+func TestRedactFieldsLoginBodies(t *testing.T) {
+	tests := []struct{ body, want string }{
+		{`{"userId":"01USER","code":123456}`, `{"userId":"01USER","code":"REDACTED"}`},
+		{`{"loginCode": 654321}`, `{"loginCode": "REDACTED"}`},
+		{`{"token":"TOKEN1","remainingAttempts":3}`, `{"token":"REDACTED","remainingAttempts":3}`},
+		{`{"error":"invalid login code","remainingAttempts":2}`, `{"error":"invalid login code","remainingAttempts":2}`},
+		{`{"privateKey":"a\"b","email":"a@b.c"}`, `{"privateKey":"REDACTED","email":"a@b.c"}`},
+	}
+	for _, tt := range tests {
+		if got := string(redactFields([]byte(tt.body))); got != tt.want {
+			t.Errorf("redactFields(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestDebugDumpsRedactLogin(t *testing.T) {
+	f := newFakeApi(t)
+	withLogger(t, "console", "debug")
+	var userId, token string
+	out := captureOutput(t, func() { userId, token = loginNewUser(t) })
+	code := strconv.Itoa(f.users[userId].LoginCode)
+	for _, secret := range []string{`"code":` + code, `"loginCode":` + code, token} {
+		if strings.Contains(out, secret) {
+			t.Errorf("debug output leaks %q", secret)
+		}
+	}
+}
+
+func TestLoggingTransport(t *testing.T) {
+	var gotId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotId = r.Header.Get(requestIdHeader)
+		w.Write([]byte(`{"token":"secret-token"}`))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: loggingTransport{next: http.DefaultTransport}}
+
+	withLogger(t, "console", "debug")
+	out := captureOutput(t, func() {
+		req, _ := http.NewRequest("POST", server.URL+"/api/user/login/", strings.NewReader(`{"password":"hunter2"}`))
+		req.Header.Set("Admin-Authorization", "secret-sig")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	})
+	if gotId == "" || !strings.Contains(out, "request_id="+gotId) {
+		t.Errorf("request id %q not logged:\n%s", gotId, out)
+	}
+	if !strings.Contains(out, "status=200") || !strings.Contains(out, "path=/api/user/login/") {
+		t.Errorf("request not logged:\n%s", out)
+	}
+	for _, secret := range []string{"secret-sig", "hunter2", "secret-token"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("debug output leaks %q:\n%s", secret, out)
+		}
+	}
+
+	logLevel.Set(slog.LevelInfo)
+	out = captureOutput(t, func() {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	})
+	if out != "" {
+		t.Errorf("info level logged requests:\n%s", out)
+	}
+}
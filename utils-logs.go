@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// systemd units whose journals can be streamed, by short name.
+var logUnits = map[string]string{
+	"cp-api": "cp-api",
+	"caddy":  "caddy",
+}
+
+// Builds ssh commands for log streaming; tests substitute local commands.
+var logSSHCommand = sshCommand
+
+// One line of a remote journal.
+type logLine struct {
+	Server string
+	Unit   string
+	Text   string
+}
+
+// Which lines of a log stream are shown.
+type logFilter struct {
+	// Only lines marked "[err]" when set.
+	ErrorsOnly bool
+	// Case-insensitive substring lines must contain, if not empty.
+	Contains string
+}
+
+func (f logFilter) matches(text string) bool {
+	if f.ErrorsOnly && !strings.Contains(text, "[err]") {
+		return false
+	}
+	return f.Contains == "" || strings.Contains(strings.ToLower(text), strings.ToLower(f.Contains))
+}
+
+// Quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Returns the journalctl command for a unit over a time window. since and
+// until take anything journalctl accepts ("2024-01-31 10:00", "-1h",
+// "today"); with follow set, new lines keep streaming after the window.
+func journalctlCommand(unit string, since string, until string, follow bool) string {
+	cmd := "journalctl --no-pager -o short-iso -u " + shellQuote(unit)
+	if since != "" {
+		cmd += " --since " + shellQuote(since)
+	}
+	if until != "" {
+		cmd += " --until " + shellQuote(until)
+	}
+	if follow {
+		cmd += " -f"
+	}
+	return cmd
+}
+
+// Formats a line for the terminal, highlighting errors in red.
+func formatLogLine(l logLine, color bool) string {
+	s := fmt.Sprintf("[%s %s] %s", l.Server, l.Unit, l.Text)
+	if color && strings.Contains(l.Text, "[err]") {
+		return "\033[31m" + s + "\033[0m"
+	}
+	return s
+}
+
+// Starts journalctl on every server for every unit and merges their lines
+// onto the returned channel, which is closed once all streams end. Calling
+// stop kills the streams; their readers then exit without waiting for lines
+// to be received, and reap the ssh processes.
+func streamLogs(servers []string, units []string, since string, until string, follow bool) (<-chan logLine, func(), error) {
+	lines := make(chan logLine)
+	done := make(chan bool)
+	var stopOnce sync.Once
+	var cmds []*exec.Cmd
+	var wg sync.WaitGroup
+	stop := func() {
+		stopOnce.Do(func() {
+			close(done)
+			for _, cmd := range cmds {
+				cmd.Process.Kill()
+			}
+		})
+	}
+
+	for _, server := range servers {
+		for _, unit := range units {
+			cmd, err := logSSHCommand(server, journalctlCommand(logUnits[unit], since, until, follow))
+			if err != nil {
+				stop()
+				return nil, nil, err
+			}
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				stop()
+				return nil, nil, err
+			}
+			cmd.Stderr = os.Stderr
+			if err := cmd.Start(); err != nil {
+				stop()
+				return nil, nil, fmt.Errorf("streaming %s logs from %s: %v", unit, server, err)
+			}
+			cmds = append(cmds, cmd)
+
+			wg.Add(1)
+			go func(server string, unit string, cmd *exec.Cmd, stdout io.Reader) {
+				defer wg.Done()
+				defer cmd.Wait()
+				scanner := bufio.NewScanner(stdout)
+				scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+				for scanner.Scan() {
+					select {
+					case lines <- logLine{Server: server, Unit: unit, Text: scanner.Text()}:
+					case <-done:
+						return
+					}
+				}
+			}(server, unit, cmd, stdout)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	return lines, stop, nil
+}
+
+// Prints matching lines from a log stream, optionally copying them (without
+// color) to w, until the stream ends or quit is closed. Returns the number of
+// lines shown.
+func showLogs(lines <-chan logLine, filter logFilter, w io.Writer, quit <-chan bool) int {
+	shown := 0
+	for {
+		select {
+		case <-quit:
+			return shown
+		case l, ok := <-lines:
+			if !ok {
+				return shown
+			}
+			if !filter.matches(l.Text) {
+				continue
+			}
+			shown++
+			fmt.Println(formatLogLine(l, true))
+			if w != nil {
+				fmt.Fprintln(w, formatLogLine(l, false))
+			}
+		}
+	}
+}
+
+// Splits a comma-separated list, dropping blanks.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Prompts for servers, units, a time window and filters, then streams the
+// matching journal lines until they end or Enter is pressed.
+func viewRemoteLogs() {
+	servers := splitList(promptWithDefault("Servers (comma separated)", "cp-1"))
+	units := splitList(promptWithDefault("Logs (cp-api, caddy; comma separated)", "cp-api,caddy"))
+	for _, unit := range units {
+		if _, ok := logUnits[unit]; !ok {
+			logErrorf("unknown log %q", unit)
+			return
+		}
+	}
+	since := promptWithDefault("Since (e.g. -1h, today, 2024-01-31 10:00)", "-15m")
+	until := promptLine("Until (blank to follow new lines): ")
+	filter := logFilter{
+		ErrorsOnly: promptWithDefault("Only [err] lines? (y/n)", "n") == "y",
+		Contains:   promptLine("Only lines containing (blank for all): "),
+	}
+	exportPath := promptLine("Also export to file (blank for none): ")
+
+	var w io.Writer
+	if exportPath != "" {
+		f, err := os.OpenFile(exportPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			logErrorf("creating export file: %v", err)
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	follow := until == ""
+	lines, stop, err := streamLogs(servers, units, since, until, follow)
+	if err != nil {
+		logErrorf("%v", err)
+		return
+	}
+	defer stop()
+
+	quit := make(chan bool)
+	if follow {
+		logInfof("following logs; press Enter to stop")
+		go func() {
+			stdinReader.ReadString('\n')
+			close(quit)
+		}()
+	}
+	shown := showLogs(lines, filter, w, quit)
+	// If the streams ended on their own, the reader above is still waiting on
+	// Enter; wait for it too, so it doesn't swallow the next line typed at the
+	// menu.
+	if follow {
+		select {
+		case <-quit:
+		default:
+			logInfof("log streams ended; press Enter to return to the menu")
+			<-quit
+		}
+	}
+	logInfof("showed %d log lines", shown)
+	if exportPath != "" {
+		logInfof("exported to %s", exportPath)
+	}
+}
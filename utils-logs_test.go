@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalctlCommand(t *testing.T) {
+	got := journalctlCommand("cp-api", "2024-01-31 10:00", "", true)
+	want := "journalctl --no-pager -o short-iso -u 'cp-api' --since '2024-01-31 10:00' -f"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got = journalctlCommand("caddy", "", "it's", false)
+	want = `journalctl --no-pager -o short-iso -u 'caddy' --until 'it'\''s'`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	tests := []struct {
+		filter logFilter
+		text   string
+		want   bool
+	}{
+		{logFilter{}, "anything", true},
+		{logFilter{ErrorsOnly: true}, "[api] started", false},
+		{logFilter{ErrorsOnly: true}, "[err][api] db locked", true},
+		{logFilter{Contains: "EXIM"}, "[api] created exim", true},
+		{logFilter{ErrorsOnly: true, Contains: "exim"}, "[err][api] db locked", false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matches(tt.text); got != tt.want {
+			t.Errorf("%+v.matches(%q) = %v, want %v", tt.filter, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLogLine(t *testing.T) {
+	l := logLine{Server: "cp-1", Unit: "cp-api", Text: "[err][api] boom"}
+	if got := formatLogLine(l, false); got != "[cp-1 cp-api] [err][api] boom" {
+		t.Errorf("plain = %q", got)
+	}
+	if got := formatLogLine(l, true); !strings.HasPrefix(got, "\033[31m") {
+		t.Errorf("colored = %q", got)
+	}
+	l.Text = "[api] ok"
+	if got := formatLogLine(l, true); strings.Contains(got, "\033[") {
+		t.Errorf("non-error line colored: %q", got)
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	old := logSSHCommand
+	t.Cleanup(func() { logSSHCommand = old })
+	logSSHCommand = func(serverName string, remoteCmd string) (*exec.Cmd, error) {
+		if !strings.Contains(remoteCmd, "--until") || strings.HasSuffix(remoteCmd, " -f") {
+			t.Errorf("unexpected remote command %q", remoteCmd)
+		}
+		return exec.Command("printf", fmt.Sprintf(`%s started\n[err] %s failed\n`, serverName, serverName)), nil
+	}
+
+	lines, stop, err := streamLogs([]string{"cp-1", "cp-2"}, []string{"cp-api", "caddy"}, "-1h", "now", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	var export strings.Builder
+	var shown int
+	out := captureOutput(t, func() {
+		shown = showLogs(lines, logFilter{ErrorsOnly: true}, &export, make(chan bool))
+	})
+	if shown != 4 {
+		t.Errorf("shown = %d, want 4\n%s", shown, out)
+	}
+	for _, want := range []string{"[cp-1 cp-api] [err] cp-1 failed", "[cp-2 caddy] [err] cp-2 failed"} {
+		if !strings.Contains(export.String(), want+"\n") {
+			t.Errorf("export missing %q:\n%s", want, export.String())
+		}
+	}
+	if strings.Contains(export.String(), "started") || strings.Contains(export.String(), "\033[") {
+		t.Errorf("export has filtered or colored lines:\n%s", export.String())
+	}
+}
+
+func TestViewRemoteLogsEndedStreamsKeepInput(t *testing.T) {
+	old := logSSHCommand
+	t.Cleanup(func() { logSSHCommand = old })
+	logSSHCommand = func(serverName string, remoteCmd string) (*exec.Cmd, error) {
+		return exec.Command("printf", "started\n"), nil
+	}
+	// Input typed as it would be: the answers up front, Enter only later.
+	oldReader := stdinReader
+	t.Cleanup(func() { stdinReader = oldReader })
+	pr, pw := io.Pipe()
+	stdinReader = bufio.NewReader(pr)
+	go fmt.Fprint(pw, "cp-1\ncp-api\n-15m\n\nn\n\n\n")
+
+	out := captureOutput(t, func() {
+		done := make(chan bool)
+		go func() {
+			viewRemoteLogs()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Error("returned after the streams ended without waiting for Enter")
+		case <-time.After(500 * time.Millisecond):
+		}
+		fmt.Fprint(pw, "\nnext\n")
+		<-done
+	})
+	if !strings.Contains(out, "log streams ended; press Enter") {
+		t.Errorf("output missing the Enter prompt:\n%s", out)
+	}
+	if got := promptLine(""); got != "next" {
+		t.Errorf("next prompt read %q, want next", got)
+	}
+}
+
+func TestStreamLogsStopReapsReaders(t *testing.T) {
+	old := logSSHCommand
+	t.Cleanup(func() { logSSHCommand = old })
+	logSSHCommand = func(serverName string, remoteCmd string) (*exec.Cmd, error) {
+		return exec.Command("yes", serverName), nil
+	}
+
+	lines, stop, err := streamLogs([]string{"cp-1", "cp-2"}, []string{"cp-api"}, "-1h", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-lines
+	// Nothing reads lines after this, as when Enter ends a follow session.
+	stop()
+	stop()
+
+	// lines is only closed once every reader has returned from cmd.Wait. Give
+	// them time to do so without receiving anything, which would unblock a
+	// reader stuck sending.
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case _, ok := <-lines:
+		if ok {
+			t.Error("reader still sending after stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("lines not closed after stop")
+	}
+}
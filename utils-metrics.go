@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Series cp-api exports that the metrics view summarizes.
+const (
+	metricRequests   = "http_requests_total"
+	metricDuration   = "http_request_duration_seconds"
+	metricGoroutines = "go_goroutines"
+	metricMemory     = "process_resident_memory_bytes"
+)
+
+// Number of scrapes kept per series for sparklines.
+const metricsHistoryLen = 30
+
+// Label names cp-api may use for the route and status code, in order of
+// preference.
+var routeLabels = []string{"route", "handler", "path"}
+var codeLabels = []string{"code", "status"}
+
+type latencyBucket struct {
+	UpperBound float64
+	// Cumulative count of observations at or below UpperBound.
+	Count float64
+}
+
+// Summarized values from one scrape of cp-api's /metrics.
+type metricsSample struct {
+	At time.Time
+	// Request and 5xx counters, summed per route.
+	Requests map[string]float64
+	Errors   map[string]float64
+	// Cumulative latency histogram buckets per route.
+	Latency     map[string][]latencyBucket
+	Goroutines  float64
+	MemoryBytes float64
+}
+
+func labelValue(m *dto.Metric, names []string) string {
+	for _, name := range names {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == name {
+				return l.GetValue()
+			}
+		}
+	}
+	return ""
+}
+
+func sampleFromFamilies(families map[string]*dto.MetricFamily, at time.Time) metricsSample {
+	s := metricsSample{
+		At:       at,
+		Requests: make(map[string]float64),
+		Errors:   make(map[string]float64),
+		Latency:  make(map[string][]latencyBucket),
+	}
+	if f, ok := families[metricRequests]; ok {
+		for _, m := range f.GetMetric() {
+			route := labelValue(m, routeLabels)
+			s.Requests[route] += m.GetCounter().GetValue()
+			if strings.HasPrefix(labelValue(m, codeLabels), "5") {
+				s.Errors[route] += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if f, ok := families[metricDuration]; ok {
+		for _, m := range f.GetMetric() {
+			route := labelValue(m, routeLabels)
+			buckets := s.Latency[route]
+			for i, b := range m.GetHistogram().GetBucket() {
+				if i < len(buckets) {
+					// Merge series that differ only in other labels.
+					buckets[i].Count += float64(b.GetCumulativeCount())
+				} else {
+					buckets = append(buckets, latencyBucket{UpperBound: b.GetUpperBound(), Count: float64(b.GetCumulativeCount())})
+				}
+			}
+			s.Latency[route] = buckets
+		}
+	}
+	if f, ok := families[metricGoroutines]; ok && len(f.GetMetric()) > 0 {
+		s.Goroutines = f.GetMetric()[0].GetGauge().GetValue()
+	}
+	if f, ok := families[metricMemory]; ok && len(f.GetMetric()) > 0 {
+		s.MemoryBytes = f.GetMetric()[0].GetGauge().GetValue()
+	}
+	return s
+}
+
+// Estimates quantile q from cumulative histogram buckets, interpolating
+// linearly within the bucket the quantile falls in (as PromQL does).
+func histogramQuantile(q float64, buckets []latencyBucket) float64 {
+	if len(buckets) == 0 {
+		return math.NaN()
+	}
+	total := buckets[len(buckets)-1].Count
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := q * total
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, b := range buckets {
+		if b.Count >= rank {
+			if math.IsInf(b.UpperBound, 1) {
+				return lowerBound
+			}
+			if b.Count == lowerCount {
+				return b.UpperBound
+			}
+			return lowerBound + (b.UpperBound-lowerBound)*(rank-lowerCount)/(b.Count-lowerCount)
+		}
+		lowerBound, lowerCount = b.UpperBound, b.Count
+	}
+	return lowerBound
+}
+
+// Derives displayable series from two consecutive samples: per-route request
+// rate and p95 latency over the interval, overall 5xx error rate, and the
+// current goroutine count and memory use.
+func deriveMetrics(prev metricsSample, cur metricsSample) map[string]float64 {
+	values := map[string]float64{
+		"goroutines": cur.Goroutines,
+		"memory MB":  cur.MemoryBytes / (1 << 20),
+	}
+	secs := cur.At.Sub(prev.At).Seconds()
+	if secs <= 0 {
+		return values
+	}
+
+	var requests, errors float64
+	for route, count := range cur.Requests {
+		// A counter going backwards means cp-api restarted.
+		delta := count - prev.Requests[route]
+		if delta < 0 {
+			delta = count
+		}
+		errDelta := cur.Errors[route] - prev.Errors[route]
+		if errDelta < 0 {
+			errDelta = cur.Errors[route]
+		}
+		requests += delta
+		errors += errDelta
+		values["req/s "+route] = delta / secs
+	}
+	if requests > 0 {
+		values["error %"] = 100 * errors / requests
+	} else {
+		values["error %"] = 0
+	}
+
+	for route, buckets := range cur.Latency {
+		interval := make([]latencyBucket, len(buckets))
+		prevBuckets := prev.Latency[route]
+		for i, b := range buckets {
+			interval[i] = b
+			if i < len(prevBuckets) && prevBuckets[i].Count <= b.Count {
+				interval[i].Count -= prevBuckets[i].Count
+			}
+		}
+		if p95 := histogramQuantile(0.95, interval); !math.IsNaN(p95) {
+			values["p95 ms "+route] = p95 * 1000
+		}
+	}
+	return values
+}
+
+// Recent values of each derived series, for sparklines and deltas.
+type metricsHistory struct {
+	values map[string][]float64
+}
+
+func (h *metricsHistory) add(values map[string]float64) {
+	if h.values == nil {
+		h.values = make(map[string][]float64)
+	}
+	for name, v := range values {
+		series := append(h.values[name], v)
+		if len(series) > metricsHistoryLen {
+			series = series[len(series)-metricsHistoryLen:]
+		}
+		h.values[name] = series
+	}
+}
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// Renders values as a line of block characters scaled between their min and
+// max.
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(sparkRunes)-1))
+		}
+		b.WriteRune(sparkRunes[i])
+	}
+	return b.String()
+}
+
+func printMetrics(h *metricsHistory, source string) {
+	names := make([]string, 0, len(h.values))
+	for name := range h.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("--- cp-api metrics from %s as of %s ---\n", source, time.Now().Format(time.RFC3339))
+	fmt.Printf("%-36s %-*s %12s %12s\n", "SERIES", metricsHistoryLen, "HISTORY", "NOW", "DELTA")
+	for _, name := range names {
+		series := h.values[name]
+		cur := series[len(series)-1]
+		delta := "-"
+		if len(series) > 1 {
+			delta = fmt.Sprintf("%+.2f", cur-series[len(series)-2])
+		}
+		fmt.Printf("%-36s %-*s %12.2f %12s\n", truncate(name, 36), metricsHistoryLen, sparkline(series), cur, delta)
+	}
+}
+
+// Scrapes and parses the metrics endpoint at baseUrl.
+func scrapeMetrics(baseUrl string) (metricsSample, error) {
+	res, err := apiClient.Get(baseUrl + "/metrics")
+	if err != nil {
+		return metricsSample{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return metricsSample{}, fmt.Errorf("GET /metrics returned %s", res.Status)
+	}
+	// Parse the text exposition format into metric families.
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(res.Body)
+	if err != nil {
+		return metricsSample{}, fmt.Errorf("parsing metrics: %v", err)
+	}
+	return sampleFromFamilies(families, time.Now()), nil
+}
+
+// Forwards a free local port to remotePort on a remote server over SSH,
+// returning the local base URL and a function that closes the tunnel.
+func openSSHTunnel(serverName string, remotePort int) (string, func(), error) {
+	target, err := sshTarget(serverName)
+	if err != nil {
+		return "", nil, err
+	}
+	// Ask the OS for a free port, then hand it to ssh.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	localAddr := l.Addr().String()
+	l.Close()
+	_, localPort, _ := net.SplitHostPort(localAddr)
+
+	cmd := exec.Command("ssh", "-N", "-o", "ExitOnForwardFailure=yes", "-L", fmt.Sprintf("%s:localhost:%d", localPort, remotePort), target)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return "", nil, err
+	}
+	closeTunnel := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	_, err = waitForHealthy(func() error {
+		if !portOpen(localAddr) {
+			return fmt.Errorf("tunnel port %s not open", localPort)
+		}
+		return nil
+	}, 10*time.Second)
+	if err != nil {
+		closeTunnel()
+		return "", nil, err
+	}
+	return "http://" + localAddr, closeTunnel, nil
+}
+
+// Scrapes cp-api's metrics locally or through an SSH tunnel and shows key
+// series as sparklines, refreshing until Enter is pressed.
+func metricsDashboard() {
+	source := promptWithDefault("Scrape metrics from (local or server name, e.g. cp-1)", localSource)
+	secs, err := strconv.Atoi(promptWithDefault("Scrape every N seconds", "5"))
+	if err != nil || secs < 1 {
+		logErrorf("scrape interval must be a positive integer")
+		return
+	}
+
+	baseUrl := apiBaseUrl
+	if source != localSource {
+		var closeTunnel func()
+		baseUrl, closeTunnel, err = openSSHTunnel(source, 8000)
+		if err != nil {
+			logErrorf("opening ssh tunnel to %s: %v", source, err)
+			return
+		}
+		defer closeTunnel()
+	}
+
+	var history metricsHistory
+	var prev metricsSample
+	var scrapeErr error
+	refreshUntilEnter(time.Duration(secs)*time.Second,
+		func() {
+			var cur metricsSample
+			cur, scrapeErr = scrapeMetrics(baseUrl)
+			if scrapeErr != nil {
+				return
+			}
+			if !prev.At.IsZero() {
+				history.add(deriveMetrics(prev, cur))
+			}
+			prev = cur
+		},
+		func() {
+			if scrapeErr != nil {
+				logErrorf("scraping metrics: %v", scrapeErr)
+			}
+			printMetrics(&history, source)
+		})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScrapeMetrics(t *testing.T) {
+	f := newFakeApi(t)
+	s, err := scrapeMetrics(f.server.URL)
+	if err != nil {
+		t.Fatalf("scrapeMetrics: %v", err)
+	}
+	if s.Requests["/api/user/signup/"] != 10 || s.Errors["/api/user/signup/"] != 1 || s.Requests["/api/user/login/"] != 5 {
+		t.Errorf("requests = %v, errors = %v", s.Requests, s.Errors)
+	}
+	if s.Goroutines != 11 || s.MemoryBytes != 64<<20 || len(s.Latency["/api/user/signup/"]) != 3 {
+		t.Errorf("sample = %+v", s)
+	}
+}
+
+func TestDeriveMetrics(t *testing.T) {
+	f := newFakeApi(t)
+	prev, _ := scrapeMetrics(f.server.URL)
+	cur, _ := scrapeMetrics(f.server.URL)
+	// Pretend the scrapes were two seconds apart.
+	cur.At = prev.At.Add(2 * time.Second)
+
+	v := deriveMetrics(prev, cur)
+	if v["req/s /api/user/signup/"] != 5 || v["req/s /api/user/login/"] != 2.5 {
+		t.Errorf("rates = %v", v)
+	}
+	if math.Abs(v["error %"]-100.0/15) > 1e-9 {
+		t.Errorf("error %% = %v", v["error %"])
+	}
+	// Half the interval's observations are under 50ms and the rest under
+	// 100ms, so p95 interpolates to 95ms.
+	if math.Abs(v["p95 ms /api/user/signup/"]-95) > 1e-9 {
+		t.Errorf("p95 = %v", v["p95 ms /api/user/signup/"])
+	}
+	if v["goroutines"] != 12 || v["memory MB"] != 64 {
+		t.Errorf("gauges = %v", v)
+	}
+
+	// A restarted server's counters reset; treat the new values as the delta.
+	restarted := cur
+	restarted.At = cur.At.Add(time.Second)
+	restarted.Requests = map[string]float64{"/api/user/login/": 3}
+	if v := deriveMetrics(cur, restarted); v["req/s /api/user/login/"] != 3 {
+		t.Errorf("rate after restart = %v", v["req/s /api/user/login/"])
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []latencyBucket{{0.1, 50}, {0.5, 90}, {1, 100}, {math.Inf(1), 100}}
+	for q, want := range map[float64]float64{0.5: 0.1, 0.7: 0.3, 0.95: 0.75} {
+		if got := histogramQuantile(q, buckets); math.Abs(got-want) > 1e-9 {
+			t.Errorf("q%.2f = %v, want %v", q, got, want)
+		}
+	}
+	if !math.IsNaN(histogramQuantile(0.5, []latencyBucket{{0.1, 0}})) {
+		t.Error("expected NaN for empty histogram")
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}); got != "▁▂▃▄▅▆▇█" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := sparkline([]float64{3, 3}); got != "▁▁" {
+		t.Errorf("flat sparkline = %q", got)
+	}
+}
+
+func TestMetricsHistoryKeepsRecentValues(t *testing.T) {
+	var h metricsHistory
+	for i := 0; i < metricsHistoryLen+5; i++ {
+		h.add(map[string]float64{"goroutines": float64(i)})
+	}
+	series := h.values["goroutines"]
+	if len(series) != metricsHistoryLen || series[0] != 5 {
+		t.Errorf("history len %d starting at %v", len(series), series[0])
+	}
+}
+
+func TestMetricsDashboard(t *testing.T) {
+	f := newFakeApi(t)
+	withInput(t, "local", "1", "")
+	metricsDashboard()
+	if f.scrapes < 1 {
+		t.Error("dashboard did not scrape")
+	}
+}
@@ -1,67 +1,70 @@
 package main
 
 import (
+	"bufio"
 	"crypto"
 	cryptoRand "crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
-	"encoding/pem"
 	"fmt"
-	"io"
 	"os"
+	"strings"
 	"time"
 )
 
-// Returns a custom timestamp (cts) for time.Now() as Day/HH:MM:SS
-func cts() string {
-	t := time.Now()
-	return fmt.Sprintf("%02d/%02d%02d%02d", t.Day(), t.Hour(), t.Minute(), t.Second())
-}
+// Target naming the API server at apiBaseUrl, as opposed to a Hetzner server
+// reached over SSH by name (e.g. "cp-1").
+const localSource = "local"
+
+// Buffered reader for line input. Shared across prompts so that buffered but
+// unread lines aren't lost between them; tests swap it for canned input.
+var stdinReader = bufio.NewReader(os.Stdin)
 
-// Decodes and unmarshals the JSON response body into the provided destination,
-// or fatally exit upon error.
-func unmarshalOrExit(body io.Reader, dst interface{}) {
-	// User a decoder to read from the response body, and unmarshal the JSON.
-	decoder := json.NewDecoder(body)
-	// Ensure JSON doesn't contain unexpected fields (not present responseBody).
-	decoder.DisallowUnknownFields()
-	err := decoder.Decode(dst)
+// Prompts the user for a line of input, returning it without surrounding
+// whitespace.
+func promptLine(label string) string {
+	fmt.Print(label)
+	// Reads until the first occurrence of newline delimiter.
+	input, err := stdinReader.ReadString('\n')
 	if err != nil {
-		fmt.Printf("[err][admin] decoding & unmarshaling JSON: %v [%s]\n", err, cts())
+		logErrorf("reading user input: %v", err)
 		os.Exit(1)
 	}
+	return strings.TrimSpace(input)
 }
 
-// Reads from PEM file and sets the global private key variable.
-func setPrivateKey() {
-	// If the private key file does not exist, exit the program.
-	_, err := os.Stat("cp.pem")
-	if os.IsNotExist(err) {
-		fmt.Printf("[err][admin] private key file is not present; use Provision Local menu to generate and copy to api server: %v [%s]\n", err, cts())
-		return
-	} else {
-		// The private key file exists; read it and set global variable.
-		var privateKeyPEM []byte
-		privateKeyPEM, err := os.ReadFile("cp.pem")
-		if err != nil {
-			fmt.Printf("[err][admin] reading private key file: %v [%s]\n", err, cts())
-			os.Exit(1)
-		}
+// Prompts the user for a line of input, returning def if the line is empty.
+func promptWithDefault(label string, def string) string {
+	input := promptLine(fmt.Sprintf("%s [%s]: ", label, def))
+	if input == "" {
+		return def
+	}
+	return input
+}
 
-		// Decode the PEM file into a private key.
-		block, _ := pem.Decode(privateKeyPEM)
-		if block == nil || block.Type != "RSA PRIVATE KEY" {
-			fmt.Printf("[err][admin] decoding PEM block containing private key [%s]\n", cts())
-			os.Exit(1)
-		}
+// Redraws a full-screen view every interval until Enter is pressed. update
+// does the slow work (network calls) first so the screen is only cleared
+// once there is something to show; render then prints the view.
+func refreshUntilEnter(interval time.Duration, update func(), render func()) {
+	quit := make(chan bool)
+	go func() {
+		stdinReader.ReadString('\n')
+		close(quit)
+	}()
 
-		cpPrivateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
-		if err != nil {
-			fmt.Printf("[err][admin] parsing encoded private key: %v [%s]\n", err, cts())
-			os.Exit(1)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		update()
+		// Clear the screen and move the cursor home (see VT100 escape codes).
+		fmt.Print("\033[H\033[2J")
+		render()
+		fmt.Printf("\n(refreshing every %s; press Enter to return to the menu)\n", interval)
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
 		}
 	}
 }
@@ -70,7 +73,7 @@ func setPrivateKey() {
 func signMessage(msg string) string {
 	// Make sure private key is present in-memory (global variable).
 	if cpPrivateKey == nil {
-		fmt.Printf("[err][admin] global private key variable has not been set [%s]\n", cts())
+		logErrorf("global private key variable has not been set")
 		os.Exit(1)
 	}
 
@@ -88,15 +91,14 @@ func signMessage(msg string) string {
 	return base64.URLEncoding.EncodeToString(signature)
 }
 
-// Sets the adminAuthToken global variable.
+// Sets the adminAuthToken global variable for the acting admin.
 func setAdminAuthToken() {
-	// Make sure admin one's ULID is present in the environment.
-	adminUlid := os.Getenv("ADMIN_ONE_ULID")
-	if adminUlid == "" {
-		fmt.Printf("[err][admin] env variable ADMIN_ONE_ULID is not set [%s]\n", cts())
+	// Make sure an admin has been selected.
+	if actingAdmin.AdminId == "" {
+		logErrorf("no acting admin has been selected")
 		os.Exit(1)
 	}
 
-	signedAdminUlid := signMessage(adminUlid)
-	adminAuthToken = fmt.Sprintf("%s.%s", adminUlid, signedAdminUlid)
+	signedAdminUlid := signMessage(actingAdmin.AdminId)
+	adminAuthToken = fmt.Sprintf("%s.%s", actingAdmin.AdminId, signedAdminUlid)
 }
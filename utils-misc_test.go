@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	cryptoRand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAdminUlid = "01HADMIN000000000000000000"
+
+// Generates an in-memory private key and admin auth token shared by all tests,
+// standing in for the acting admin and their key file, and points the audit
+// log at a temp dir.
+func TestMain(m *testing.M) {
+	key, err := rsa.GenerateKey(cryptoRand.Reader, 2048)
+	if err != nil {
+		fmt.Printf("generating test private key: %v\n", err)
+		os.Exit(1)
+	}
+	cpPrivateKey = key
+	actingAdmin = adminIdentity{Name: "test-admin", Email: "admin@email.com", AdminId: testAdminUlid}
+	setAdminAuthToken()
+
+	// Keep audit records and sessions written by tests out of the working tree.
+	dir, err := os.MkdirTemp("", "cp-admin-test")
+	if err != nil {
+		fmt.Printf("creating temp dir: %v\n", err)
+		os.Exit(1)
+	}
+	auditLogPath = filepath.Join(dir, "audit.jsonl")
+	sessionStoreDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSignMessageVerifiesWithPublicKey(t *testing.T) {
+	sig, err := base64.URLEncoding.DecodeString(signMessage("hello"))
+	if err != nil {
+		t.Fatalf("decoding signature: %v", err)
+	}
+	hashed := sha256.Sum256([]byte("hello"))
+	if err := rsa.VerifyPKCS1v15(&cpPrivateKey.PublicKey, crypto.SHA256, hashed[:], sig); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
+
+func TestSetAdminAuthToken(t *testing.T) {
+	ulid, sig, ok := strings.Cut(adminAuthToken, ".")
+	if !ok {
+		t.Fatalf("admin auth token %q is not <ulid>.<signature>", adminAuthToken)
+	}
+	if ulid != testAdminUlid {
+		t.Errorf("ulid = %q, want %q", ulid, testAdminUlid)
+	}
+	if sig == "" {
+		t.Error("signature is empty")
+	}
+}
+
+// Feeds the given lines to promptLine for the duration of the test.
+func withInput(t *testing.T, lines ...string) {
+	t.Helper()
+	old := stdinReader
+	stdinReader = bufio.NewReader(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+	t.Cleanup(func() { stdinReader = old })
+}
+
+// Returns what fn prints to stdout.
+func captureOutput(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	os.Stdout = old
+	w.Close()
+	return <-out
+}
+
+func TestPromptWithDefault(t *testing.T) {
+	withInput(t, "", "  7  ")
+	if got := promptWithDefault("Users", "10"); got != "10" {
+		t.Errorf("empty input = %q, want default", got)
+	}
+	if got := promptWithDefault("Users", "10"); got != "7" {
+		t.Errorf("input = %q, want %q", got, "7")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Number of exims listed per page of the moderation queue.
+const moderationPageSize = 5
+
+// Truncates s to at most n characters (runes), marking the cut with "...".
+func truncate(s string, n int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// Returns the exims matching filter, which is either "field=value" (fields:
+// target, author, title, link; title and link match substrings) or plain text
+// matched against the title and summary. Matching ignores case.
+func filterExims(exims []eximRecord, filter string) []eximRecord {
+	field, value, hasField := strings.Cut(filter, "=")
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !hasField {
+		value = strings.ToLower(strings.TrimSpace(filter))
+	}
+	var matched []eximRecord
+	for _, e := range exims {
+		var ok bool
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "target":
+			ok = strings.ToLower(e.Target) == value
+		case "author":
+			ok = strings.ToLower(e.Author) == value
+		case "title":
+			ok = strings.Contains(strings.ToLower(e.Title), value)
+		case "link":
+			ok = strings.Contains(strings.ToLower(e.Link), value)
+		default:
+			ok = strings.Contains(strings.ToLower(e.Title), value) || strings.Contains(strings.ToLower(e.Summary), value)
+		}
+		if ok {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// Removes the exim with the given id from the queue.
+func removeExim(exims []eximRecord, eximId string) []eximRecord {
+	for i, e := range exims {
+		if e.EximId == eximId {
+			return append(exims[:i], exims[i+1:]...)
+		}
+	}
+	return exims
+}
+
+func printModerationPage(queue []eximRecord, page int) {
+	pages := (len(queue) + moderationPageSize - 1) / moderationPageSize
+	fmt.Printf("\n--- Moderation queue: %d unapproved, page %d/%d ---\n", len(queue), page+1, pages)
+	for i := page * moderationPageSize; i < len(queue) && i < (page+1)*moderationPageSize; i++ {
+		e := queue[i]
+		fmt.Printf("[%d] %s  target: %s  author: %s\n", i+1, truncate(e.Title, 60), e.Target, e.Author)
+		fmt.Printf("    summary: %s\n", truncate(e.Summary, 100))
+		fmt.Printf("    link: %s\n", e.Link)
+	}
+	fmt.Println("-------------------------------------")
+}
+
+func printEximFull(e eximRecord) {
+	fmt.Printf("\nexim: %s\ntarget: %s\nauthor: %s\ntitle: %s\nsummary: %s\n\n%s\n\n%s\n\n%s\n\nlink: %s\n",
+		e.EximId, e.Target, e.Author, e.Title, e.Summary, e.Paragraph1, e.Paragraph2, e.Paragraph3, e.Link)
+}
+
+// Interactive moderation view over unapproved exims. Lets an admin page
+// through the queue, read an exim in full, approve or reject it, and
+// bulk-approve every exim matching a filter.
+func moderateEximQueue() {
+	queue, err := getUnapprovedExims()
+	if err != nil {
+		return
+	}
+	if len(queue) == 0 {
+		logInfof("moderation queue is empty")
+		return
+	}
+
+	page := 0
+	for len(queue) > 0 {
+		pages := (len(queue) + moderationPageSize - 1) / moderationPageSize
+		if page >= pages {
+			page = pages - 1
+		}
+		printModerationPage(queue, page)
+		input := promptLine("n/p page, r # read, a # approve, x # reject, b <filter> bulk approve, q quit: ")
+		cmd, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch cmd {
+		case "n":
+			if page < pages-1 {
+				page++
+			}
+		case "p":
+			if page > 0 {
+				page--
+			}
+		case "r", "a", "x":
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < 1 || i > len(queue) {
+				logErrorf("no exim numbered %q in the queue", arg)
+				continue
+			}
+			e := queue[i-1]
+			switch cmd {
+			case "r":
+				printEximFull(e)
+			case "a":
+				if approveExim(e.EximId) == nil {
+					logInfof("approved exim %s", e.EximId)
+					queue = removeExim(queue, e.EximId)
+				}
+			case "x":
+				if rejectExim(e.EximId) == nil {
+					logInfof("rejected exim %s", e.EximId)
+					queue = removeExim(queue, e.EximId)
+				}
+			}
+		case "b":
+			matched := filterExims(queue, arg)
+			if len(matched) == 0 {
+				logInfof("no exims match filter %q", arg)
+				continue
+			}
+			confirm := promptLine(fmt.Sprintf("Approve %d exims matching %q? (y/n): ", len(matched), arg))
+			if confirm != "y" && confirm != "Y" {
+				continue
+			}
+			approved := 0
+			for _, e := range matched {
+				if approveExim(e.EximId) == nil {
+					approved++
+					queue = removeExim(queue, e.EximId)
+				}
+			}
+			logInfof("bulk approved %d of %d exims", approved, len(matched))
+		case "q":
+			return
+		}
+	}
+	logInfof("moderation queue is empty")
+}
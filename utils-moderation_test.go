@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestFilterExims(t *testing.T) {
+	exims := []eximRecord{
+		{EximId: "1", Target: "FEDERAL", Author: "A", Title: "Clean Water Act", Summary: "rivers", Link: "https://water.org"},
+		{EximId: "2", Target: "STATE", Author: "B", Title: "Road repair", Summary: "potholes and water mains"},
+		{EximId: "3", Target: "federal", Author: "a", Title: "Tax reform"},
+	}
+	cases := []struct {
+		filter string
+		want   []string
+	}{
+		{"target=FEDERAL", []string{"1", "3"}},
+		{"author=A", []string{"1", "3"}},
+		{"title=road", []string{"2"}},
+		{"link=water.org", []string{"1"}},
+		{"water", []string{"1", "2"}},
+		{"nothing", nil},
+	}
+	for _, c := range cases {
+		got := filterExims(exims, c.filter)
+		if len(got) != len(c.want) {
+			t.Errorf("filter %q matched %d exims, want %d", c.filter, len(got), len(c.want))
+			continue
+		}
+		for i := range got {
+			if got[i].EximId != c.want[i] {
+				t.Errorf("filter %q match %d = %s, want %s", c.filter, i, got[i].EximId, c.want[i])
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("short", 10); got != "short" {
+		t.Errorf("truncate short = %q", got)
+	}
+	if got := truncate("日本語日本語日本語", 6); got != "日本語..." {
+		t.Errorf("truncate unicode = %q", got)
+	}
+}
+
+func TestModerationEndpoints(t *testing.T) {
+	f := newFakeApi(t)
+	_, token := loginNewUser(t)
+	first, second := createExim(token), createExim(token)
+
+	queue, err := getUnapprovedExims()
+	if err != nil || len(queue) != 2 {
+		t.Fatalf("unapproved = %d (err %v), want 2", len(queue), err)
+	}
+	if err := approveExim(first); err != nil {
+		t.Fatalf("approveExim: %v", err)
+	}
+	if err := rejectExim(second); err != nil {
+		t.Fatalf("rejectExim: %v", err)
+	}
+	if !f.exims[first].IsApproved {
+		t.Error("approved exim not marked approved")
+	}
+	if _, ok := f.exims[second]; ok {
+		t.Error("rejected exim still stored")
+	}
+	if err := approveExim("missing"); err == nil {
+		t.Error("expected error approving missing exim")
+	}
+	if queue, _ := getUnapprovedExims(); len(queue) != 0 {
+		t.Errorf("unapproved after moderation = %d, want 0", len(queue))
+	}
+}
+
+func TestModerateEximQueue(t *testing.T) {
+	f := newFakeApi(t)
+	_, token := loginNewUser(t)
+	var ids []string
+	for _, target := range []string{"FEDERAL", "STATE", "FEDERAL", "CITY", "FEDERAL", "STATE", "CITY"} {
+		fields := generateEximFields(eximDataTypical)
+		fields.Target = target
+		ids = append(ids, createEximWithFields(token, fields))
+	}
+
+	// Page forward and back, read #1, reject #1, approve the new #1 (ids[1]),
+	// then bulk approve remaining FEDERAL exims and quit.
+	withInput(t, "n", "p", "r 1", "x 1", "a 1", "a 99", "b target=FEDERAL", "y", "q")
+	moderateEximQueue()
+
+	if _, ok := f.exims[ids[0]]; ok {
+		t.Error("exim 1 should have been rejected")
+	}
+	for _, i := range []int{1, 2, 4} {
+		if !f.exims[ids[i]].IsApproved {
+			t.Errorf("exim %d should have been approved", i+1)
+		}
+	}
+	for _, i := range []int{3, 5, 6} {
+		if f.exims[ids[i]].IsApproved {
+			t.Errorf("exim %d should still be unapproved", i+1)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Returns a Go type name as an OpenAPI component name, e.g. "SignupResponse".
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// Returns the OpenAPI schema for a Go type, adding named structs to
+// components and referring to them.
+func openAPISchema(t reflect.Type, components map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		// cp-api is written in Go, so empty slices may be sent as null.
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), components), "nullable": true}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), components), "nullable": true}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + componentName(t)}
+		if _, ok := components[componentName(t)]; ok {
+			return ref
+		}
+		// Reserve the name first in case the type refers to itself.
+		components[componentName(t)] = nil
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = openAPISchema(f.Type, components)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		components[componentName(t)] = schema
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// Returns an operationId for a contract, e.g. "getApiEximEximId".
+func operationId(c apiContract) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(c.Method))
+	for _, word := range strings.FieldsFunc(c.Route, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// Description of endpoints and parameters cp-admin assumes cp-api provides.
+const assumedDescription = "Assumed by cp-admin; not confirmed to exist in cp-api."
+
+// Builds an OpenAPI 3 document describing every endpoint in apiContracts.
+// Assumed endpoints and parameters are described as such and flagged with
+// x-cp-admin-assumed.
+func generateOpenAPI() map[string]interface{} {
+	components := make(map[string]interface{})
+	errorSchema := openAPISchema(reflect.TypeOf(errorResponse{}), components)
+	paths := make(map[string]interface{})
+
+	for _, c := range apiContracts {
+		op := map[string]interface{}{
+			"summary":     c.Summary,
+			"operationId": operationId(c),
+		}
+		if c.Assumed {
+			op["description"] = assumedDescription
+			op["x-cp-admin-assumed"] = true
+		}
+
+		var parameters []interface{}
+		for _, segment := range strings.Split(c.Route, "/") {
+			if strings.HasPrefix(segment, "{") {
+				parameters = append(parameters, map[string]interface{}{
+					"name": strings.Trim(segment, "{}"), "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		for _, name := range c.Query {
+			param := map[string]interface{}{
+				"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"},
+			}
+			if slices.Contains(c.AssumedQuery, name) {
+				param["description"] = assumedDescription
+				param["x-cp-admin-assumed"] = true
+			}
+			parameters = append(parameters, param)
+		}
+		if len(parameters) > 0 {
+			op["parameters"] = parameters
+		}
+
+		if c.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(c.Request), components)},
+				},
+			}
+		}
+		switch c.Auth {
+		case "bearer":
+			op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		case "admin":
+			op["security"] = []interface{}{map[string]interface{}{"adminAuth": []string{}}}
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(c.Status)}
+		if c.Response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(c.Response), components)},
+			}
+		} else if c.Binary {
+			success["content"] = map[string]interface{}{
+				"application/octet-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+			}
+		}
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(c.Status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorSchema},
+				},
+			},
+		}
+
+		path, ok := paths[c.Route].(map[string]interface{})
+		if !ok {
+			path = make(map[string]interface{})
+			paths[c.Route] = path
+		}
+		path[strings.ToLower(c.Method)] = op
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var servers []interface{}
+	for _, name := range names {
+		servers = append(servers, map[string]interface{}{"url": profiles[name], "description": name})
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "cp-api",
+			"version":     "1",
+			"description": "Generated by cp-admin from the requests it makes and the responses it decodes.",
+		},
+		"servers": servers,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "Session token from /api/user/login-code/."},
+				"adminAuth": map[string]interface{}{
+					"type": "apiKey", "in": "header", "name": "Admin-Authorization",
+					"description": "<admin ULID>.<base64url RSA PKCS #1 v1.5 SHA-256 signature of the ULID>, signed with the admin's registered key.",
+				},
+			},
+		},
+	}
+}
+
+// Writes the generated document to path, as YAML for .yaml/.yml files and
+// JSON otherwise.
+func writeOpenAPI(path string) error {
+	doc := generateOpenAPI()
+	var data []byte
+	var err error
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		data, err = yaml.Marshal(doc)
+	} else {
+		data, err = json.MarshalIndent(doc, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Prompts for a file and writes the generated OpenAPI document to it.
+func runGenerateOpenAPI() {
+	path := promptWithDefault("Write OpenAPI document to", "openapi.yaml")
+	if err := writeOpenAPI(path); err != nil {
+		logErrorf("writing OpenAPI document: %v", err)
+		return
+	}
+	logInfof("wrote OpenAPI document for %d operations to %s", len(apiContracts), path)
+}
+
+// Converts YAML's non-string-keyed maps so documents can be walked as JSON.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = normalizeYAML(elem)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(elem)
+		}
+		return m
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalizeYAML(elem)
+		}
+	}
+	return v
+}
+
+// Reads an OpenAPI document in YAML or JSON.
+func loadOpenAPI(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	m, ok := normalizeYAML(doc).(map[string]interface{})
+	if !ok || m["paths"] == nil {
+		return nil, fmt.Errorf("%s is not an OpenAPI document", path)
+	}
+	return m, nil
+}
+
+// Resolves a local "#/..." reference within doc.
+func resolveRef(doc map[string]interface{}, ref string) (map[string]interface{}, error) {
+	parts, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var v interface{} = doc
+	for _, part := range strings.Split(parts, "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("$ref %q not found", ref)
+		}
+		v = m[part]
+	}
+	schema, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$ref %q not found", ref)
+	}
+	return schema, nil
+}
+
+// Finds the JSON schema a response to method and path with status should
+// match. A nil schema means the response has no JSON body to check.
+func responseSchema(doc map[string]interface{}, method string, path string, status int) (string, map[string]interface{}, error) {
+	paths, _ := doc["paths"].(map[string]interface{})
+	route, params := "", -1
+	for candidate := range paths {
+		if !routeMatches(candidate, path) {
+			continue
+		}
+		// Prefer literal segments over parameters.
+		n := strings.Count(candidate, "{")
+		if params == -1 || n < params {
+			route, params = candidate, n
+		}
+	}
+	if route == "" {
+		return "", nil, fmt.Errorf("no path in spec matches %s", path)
+	}
+	item, _ := paths[route].(map[string]interface{})
+	op, ok := item[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		return route, nil, fmt.Errorf("spec has no %s operation for %s", method, route)
+	}
+	responses, _ := op["responses"].(map[string]interface{})
+	code := strconv.Itoa(status)
+	res, ok := responses[code].(map[string]interface{})
+	if !ok {
+		res, ok = responses[code[:1]+"XX"].(map[string]interface{})
+	}
+	if !ok {
+		res, ok = responses["default"].(map[string]interface{})
+	}
+	if !ok {
+		return route, nil, fmt.Errorf("spec has no %d response for %s %s", status, method, route)
+	}
+	if ref, ok := res["$ref"].(string); ok {
+		var err error
+		if res, err = resolveRef(doc, ref); err != nil {
+			return route, nil, err
+		}
+	}
+	content, _ := res["content"].(map[string]interface{})
+	media, _ := content["application/json"].(map[string]interface{})
+	schema, _ := media["schema"].(map[string]interface{})
+	return route, schema, nil
+}
+
+func jsonPath(parent string, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+// Validates a decoded JSON value against an OpenAPI schema, returning a
+// message for each violation.
+func validateSchema(doc map[string]interface{}, schema map[string]interface{}, v interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolveRef(doc, ref)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		return validateSchema(doc, resolved, v, path)
+	}
+	at := path
+	if at == "" {
+		at = "(body)"
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		var errs []string
+		for _, sub := range all {
+			subSchema, _ := sub.(map[string]interface{})
+			errs = append(errs, validateSchema(doc, subSchema, v, path)...)
+		}
+		return errs
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alternatives, ok := schema[key].([]interface{}); ok {
+			for _, sub := range alternatives {
+				subSchema, _ := sub.(map[string]interface{})
+				if len(validateSchema(doc, subSchema, v, path)) == 0 {
+					return nil
+				}
+			}
+			return []string{fmt.Sprintf("%s: matches none of %s", at, key)}
+		}
+	}
+
+	if v == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schema["type"] == nil {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: is null", at)}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(v) {
+				found = true
+			}
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: %v is not one of %v", at, v, enum)}
+		}
+	}
+
+	wrongType := func(want string) []string {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", at, want, observedType(v))}
+	}
+	switch schema["type"] {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return wrongType("string")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return wrongType("boolean")
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return wrongType("number")
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != math.Trunc(f) {
+			return wrongType("integer")
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return wrongType("array")
+		}
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		var errs []string
+		for i, item := range items {
+			errs = append(errs, validateSchema(doc, itemSchema, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return wrongType("object")
+		}
+		var errs []string
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[fmt.Sprint(name)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required field", jsonPath(path, fmt.Sprint(name))))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := properties[name].(map[string]interface{}); ok {
+				errs = append(errs, validateSchema(doc, prop, obj[name], jsonPath(path, name))...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: not allowed by spec", jsonPath(path, name)))
+				}
+			case map[string]interface{}:
+				errs = append(errs, validateSchema(doc, extra, obj[name], jsonPath(path, name))...)
+			}
+		}
+		return errs
+	}
+	return nil
+}
+
+// Returns the JSON type of a decoded value, for messages.
+func observedType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "null"
+}
+
+// Result of validating one response against an OpenAPI document.
+type specResult struct {
+	Exchange recordedExchange
+	Route    string
+	Errors   []string
+}
+
+// Validates each exchange's response against doc.
+func validateExchanges(doc map[string]interface{}, exchanges []recordedExchange) []specResult {
+	var results []specResult
+	for _, e := range exchanges {
+		if e.Error != "" || e.Status == 0 {
+			continue
+		}
+		path, _, _ := strings.Cut(recordedPath(e.Url), "?")
+		route, schema, err := responseSchema(doc, e.Method, path, e.Status)
+		r := specResult{Exchange: e, Route: route}
+		switch {
+		case err != nil:
+			r.Errors = []string{err.Error()}
+		case schema != nil:
+			var v interface{}
+			if err := json.Unmarshal([]byte(e.ResponseBody), &v); err != nil {
+				r.Errors = []string{"(body): not JSON: " + err.Error()}
+			} else {
+				r.Errors = validateSchema(doc, schema, v, "")
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Validates live or recorded cp-api responses against a supplied OpenAPI
+// document and reports each violation.
+func runValidateOpenAPI() {
+	doc, err := loadOpenAPI(promptWithDefault("OpenAPI document", "openapi.yaml"))
+	if err != nil {
+		logErrorf("loading OpenAPI document: %v", err)
+		return
+	}
+	source := promptWithDefault("Validate live responses or a session file (live or path)", "live")
+	var exchanges []recordedExchange
+	if source == "live" {
+		exchanges = fetchLiveExchanges()
+	} else if exchanges, err = readRecording(source); err != nil {
+		logErrorf("reading session: %v", err)
+		return
+	}
+
+	failed := 0
+	for _, r := range validateExchanges(doc, exchanges) {
+		endpoint := fmt.Sprintf("%s %s %d", r.Exchange.Method, recordedPath(r.Exchange.Url), r.Exchange.Status)
+		if len(r.Errors) == 0 {
+			fmt.Printf("%-56s ok\n", truncate(endpoint, 56))
+			continue
+		}
+		failed++
+		fmt.Printf("%-56s [err]\n", truncate(endpoint, 56))
+		for _, msg := range r.Errors {
+			fmt.Printf("    %s\n", msg)
+		}
+	}
+	if failed > 0 {
+		logWarnf("%d responses don't match the OpenAPI document", failed)
+	} else {
+		logInfof("all responses match the OpenAPI document")
+	}
+}
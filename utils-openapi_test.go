@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateOpenAPI(t *testing.T) {
+	doc := generateOpenAPI()
+	paths := doc["paths"].(map[string]interface{})
+	for _, c := range apiContracts {
+		item, ok := paths[c.Route].(map[string]interface{})
+		if !ok || item[strings.ToLower(c.Method)] == nil {
+			t.Errorf("missing %s %s", c.Method, c.Route)
+		}
+	}
+
+	op := paths["/api/admin/bypass-email/{userId}"].(map[string]interface{})["get"].(map[string]interface{})
+	if !reflect.DeepEqual(op["security"], []interface{}{map[string]interface{}{"adminAuth": []string{}}}) {
+		t.Errorf("security = %v", op["security"])
+	}
+	param := op["parameters"].([]interface{})[0].(map[string]interface{})
+	if param["name"] != "userId" || param["in"] != "path" || param["required"] != true {
+		t.Errorf("parameter = %v", param)
+	}
+
+	components := doc["components"].(map[string]interface{})
+	scheme := components["securitySchemes"].(map[string]interface{})["adminAuth"].(map[string]interface{})
+	if scheme["name"] != "Admin-Authorization" || scheme["in"] != "header" {
+		t.Errorf("adminAuth = %v", scheme)
+	}
+	schemas := components["schemas"].(map[string]interface{})
+	signup := schemas["SignupResponse"].(map[string]interface{})
+	if !reflect.DeepEqual(signup["required"], []string{"userId"}) {
+		t.Errorf("SignupResponse required = %v", signup["required"])
+	}
+	user := schemas["AdminUser"].(map[string]interface{})["properties"].(map[string]interface{})
+	if user["logoutTs"].(map[string]interface{})["format"] != "date-time" {
+		t.Errorf("AdminUser.logoutTs = %v", user["logoutTs"])
+	}
+}
+
+func TestGenerateOpenAPIFlagsAssumed(t *testing.T) {
+	old := apiContracts
+	t.Cleanup(func() { apiContracts = old })
+	apiContracts = []apiContract{
+		{Method: "POST", Route: "/api/admin/shutdown/", Auth: "admin", Query: []string{"drain"}, AssumedQuery: []string{"drain"}, Status: 204},
+		{Method: "GET", Route: "/api/admin/backup", Auth: "admin", Status: 200, Binary: true, Assumed: true},
+	}
+	paths := generateOpenAPI()["paths"].(map[string]interface{})
+
+	shutdown := paths["/api/admin/shutdown/"].(map[string]interface{})["post"].(map[string]interface{})
+	if shutdown["x-cp-admin-assumed"] != nil {
+		t.Error("known endpoint flagged as assumed")
+	}
+	drain := shutdown["parameters"].([]interface{})[0].(map[string]interface{})
+	if drain["x-cp-admin-assumed"] != true || drain["description"] != assumedDescription {
+		t.Errorf("drain = %v", drain)
+	}
+	backup := paths["/api/admin/backup"].(map[string]interface{})["get"].(map[string]interface{})
+	if backup["x-cp-admin-assumed"] != true || backup["description"] != assumedDescription {
+		t.Errorf("backup = %v", backup)
+	}
+}
+
+func TestOperationId(t *testing.T) {
+	c := apiContract{Method: "GET", Route: "/api/admin/bucket/{bucket}/key"}
+	if got := operationId(c); got != "getApiAdminBucketBucketKey" {
+		t.Errorf("operationId = %q", got)
+	}
+}
+
+func TestWriteAndLoadOpenAPI(t *testing.T) {
+	for _, name := range []string{"openapi.yaml", "openapi.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := writeOpenAPI(path); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := loadOpenAPI(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		route, schema, err := responseSchema(doc, "GET", "/api/exim/01ABC", 200)
+		if err != nil || route != "/api/exim/{eximId}" || schema["$ref"] != "#/components/schemas/EximDetailsResponse" {
+			t.Errorf("%s: route %q schema %v err %v", name, route, schema, err)
+		}
+		// Literal routes win over parameterized ones.
+		if route, _, _ := responseSchema(doc, "GET", "/api/exims", 200); route != "/api/exims" {
+			t.Errorf("%s: /api/exims matched %q", name, route)
+		}
+		if _, schema, err := responseSchema(doc, "POST", "/api/user/signup/", 400); err != nil || schema["$ref"] != "#/components/schemas/ErrorResponse" {
+			t.Errorf("%s: error response schema %v err %v", name, schema, err)
+		}
+		if _, _, err := responseSchema(doc, "GET", "/api/nothing", 200); err == nil {
+			t.Errorf("%s: unknown path matched", name)
+		}
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	spec := `
+openapi: 3.0.3
+paths: {}
+components:
+  schemas:
+    Item:
+      type: object
+      required: [name, count]
+      additionalProperties: false
+      properties:
+        name: {type: string}
+        count: {type: integer}
+        kind: {type: string, enum: [a, b]}
+`
+	path := filepath.Join(t.TempDir(), "spec.yaml")
+	os.WriteFile(path, []byte(spec), 0644)
+	doc, err := loadOpenAPI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"items": map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/Item"}}},
+	}
+
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"items":[{"name":"x","count":2,"kind":"a"}]}`, nil},
+		{`{"items":[{"name":"x","count":2.5}]}`, []string{"items[0].count: expected integer, got number"}},
+		{`{"items":[{"count":1,"kind":"c","extra":true}]}`, []string{
+			"items[0].name: missing required field",
+			"items[0].extra: not allowed by spec",
+			"items[0].kind: c is not one of [a b]",
+		}},
+		{`{"items":null}`, []string{"items: is null"}},
+	}
+	for _, tt := range tests {
+		var v interface{}
+		json.Unmarshal([]byte(tt.body), &v)
+		if got := validateSchema(doc, schema, v, ""); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: errors = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestValidateExchanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := writeOpenAPI(path); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := loadOpenAPI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchanges := []recordedExchange{
+		{Method: "GET", Url: "http://api.test/api/exims", Status: 200, ResponseBody: `{"exims":null}`},
+		{Method: "GET", Url: "http://api.test/api/exim/01ABC", Status: 404, ResponseBody: `{"error":"not found"}`},
+		{Method: "POST", Url: "http://api.test/api/user/signup/", Status: 201, ResponseBody: `{"userId":7}`},
+		{Method: "POST", Url: "http://api.test/api/admin/shutdown/?drain=5s", Status: 204},
+	}
+	results := validateExchanges(doc, exchanges)
+	if len(results) != 4 {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, want := range [][]string{nil, nil, {"userId: expected string, got number"}, nil} {
+		if !reflect.DeepEqual(results[i].Errors, want) {
+			t.Errorf("result %d errors = %q, want %q", i, results[i].Errors, want)
+		}
+	}
+}
+
+func TestRunValidateOpenAPILive(t *testing.T) {
+	newFakeApi(t)
+	_, token := loginNewUser(t)
+	createExim(token)
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := writeOpenAPI(path); err != nil {
+		t.Fatal(err)
+	}
+
+	withInput(t, path, "live")
+	out := captureOutput(t, runValidateOpenAPI)
+	if !strings.Contains(out, "all responses match the OpenAPI document") || !strings.Contains(out, "GET /api/exim/") {
+		t.Errorf("output:\n%s", out)
+	}
+}
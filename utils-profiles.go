@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Named environments cp-admin can operate against, mapped to their API base
+// URL. A profile's URL can be overridden with <PROFILE>_API_BASE_URL.
+var profiles = map[string]string{
+	"local":      "http://localhost:8000",
+	"production": "https://cooperativeparty.org",
+}
+
+// Name of the profile cp-admin is operating against.
+var activeProfile = "local"
+
+// Returns the API base URL of a profile, honoring <PROFILE>_API_BASE_URL.
+func profileBaseUrl(name string) (string, bool) {
+	baseUrl, ok := profiles[name]
+	if override := os.Getenv(strings.ToUpper(name) + "_API_BASE_URL"); ok && override != "" {
+		baseUrl = override
+	}
+	return baseUrl, ok
+}
+
+// Reports whether baseUrl points at the production API server's host and
+// port, however it was typed.
+func isProductionUrl(baseUrl string) bool {
+	productionUrl, _ := profileBaseUrl("production")
+	if u, err := neturl.Parse(baseUrl); err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(baseUrlAddr(baseUrl), baseUrlAddr(productionUrl))
+}
+
+// Makes name the active profile and points apiBaseUrl at its API server.
+func setProfile(name string) error {
+	baseUrl, ok := profileBaseUrl(name)
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q (known: %s)", name, strings.Join(names, ", "))
+	}
+	activeProfile = name
+	apiBaseUrl = baseUrl
+	return nil
+}
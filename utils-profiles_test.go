@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSetProfile(t *testing.T) {
+	oldProfile, oldBaseUrl := activeProfile, apiBaseUrl
+	t.Cleanup(func() { activeProfile, apiBaseUrl = oldProfile, oldBaseUrl })
+
+	if err := setProfile("production"); err != nil || apiBaseUrl != "https://cooperativeparty.org" {
+		t.Errorf("production: err %v, base url %s", err, apiBaseUrl)
+	}
+	t.Setenv("LOCAL_API_BASE_URL", "http://localhost:9000")
+	if err := setProfile("local"); err != nil || apiBaseUrl != "http://localhost:9000" || activeProfile != "local" {
+		t.Errorf("local override: err %v, base url %s", err, apiBaseUrl)
+	}
+	if err := setProfile("staging"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestIsProductionUrl(t *testing.T) {
+	for _, u := range []string{"https://cooperativeparty.org", "https://COOPERATIVEPARTY.org/", "https://cooperativeparty.org:443/api"} {
+		if !isProductionUrl(u) {
+			t.Errorf("%s not taken for production", u)
+		}
+	}
+	for _, u := range []string{"http://localhost:8000", "https://staging.cooperativeparty.org", "http://cooperativeparty.org:8000", "production"} {
+		if isProductionUrl(u) {
+			t.Errorf("%s taken for production", u)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	cryptoRand "crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -16,39 +15,55 @@ func generatePrivateKeyFile() {
 	_, err := os.Stat("cp.pem")
 	if os.IsExist(err) {
 		// A private key file exists. Notify user.
-		fmt.Printf("[err][admin] attempting to create private key file, but \"cp.pem\" already exists [%s]\n", cts())
+		logErrorf("attempting to create private key file, but \"cp.pem\" already exists")
 		return
 	}
 
 	// The private key file does not exist, so generate a new key.
-	cpPrivateKey, err := rsa.GenerateKey(cryptoRand.Reader, 2048)
+	_, err = writeNewPrivateKey("cp.pem")
 	if err != nil {
-		fmt.Printf("[err][admin] creating private key: %v [%s]\n", err, cts())
+		logErrorf("creating private key: %v", err)
 		os.Exit(1)
 	}
+	logInfof("private key successfully created")
+
+}
+
+// Generates a new private key and writes it to path in PEM format.
+func writeNewPrivateKey(path string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(cryptoRand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
 
 	// Encode the private key into PEM format.
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(cpPrivateKey)
+	privateKeyBytes := x509.MarshalPKCS1PrivateKey(key)
 	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
 		Type:  "RSA PRIVATE KEY",
 		Bytes: privateKeyBytes,
 	})
 
-	// Write the PEM to a file.
-	err = os.WriteFile("cp.pem", privateKeyPEM, 0600)
+	// Write the PEM to a file, refusing to overwrite an existing key.
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
 	if err != nil {
-		fmt.Printf("[err][admin] writing private key to disk: %v [%s]\n", err, cts())
-		os.Exit(1)
+		return nil, err
 	}
-	fmt.Printf("[admin] private key successfully created [%s]\n", cts())
-
+	if _, err := f.Write(privateKeyPEM); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
 }
 
 func copyPrivateKeyLocal() {
+	if dryRunSkip("copy cp.pem to %s", os.Getenv("LOCAL_CP_API_PK_PATH")) {
+		return
+	}
+
 	// Open the source file for reading
 	srcFile, err := os.Open("cp.pem")
 	if err != nil {
-		fmt.Printf("[err][admin] opening private key file: %v [%s]\n", err, cts())
+		logErrorf("opening private key file: %v", err)
 		os.Exit(1)
 	}
 	defer srcFile.Close()
@@ -56,21 +71,22 @@ func copyPrivateKeyLocal() {
 	// Create the destination file
 	dstFile, err := os.Create(os.Getenv("LOCAL_CP_API_PK_PATH"))
 	if err != nil {
-		fmt.Printf("[err][admin] creating new file in cp-api directory: %v [%s]\n", err, cts())
+		logErrorf("creating new file in cp-api directory: %v", err)
 	}
 	defer dstFile.Close()
 
 	// Use io.Copy to copy the contents of the source file to the destination file
 	_, err = io.Copy(dstFile, srcFile)
 	if err != nil {
-		fmt.Printf("[err][admin] copying old file to new file in cp-api directory: %v [%s]\n", err, cts())
+		logErrorf("copying old file to new file in cp-api directory: %v", err)
 		os.Exit(1)
 	}
 
 	// Call Sync to flush writes to stable storage
 	dstFile.Sync()
 
-	fmt.Printf("[admin] private key successfully copied to %s [%s]\n", os.Getenv("LOCAL_CP_API_PK_PATH"), cts())
+	auditAction("copy private key", map[string]string{"source": "cp.pem", "dest": os.Getenv("LOCAL_CP_API_PK_PATH")}, nil)
+	logInfof("private key successfully copied to %s", os.Getenv("LOCAL_CP_API_PK_PATH"))
 }
 
 func wrappedCopyPrivateKeyLocal() {
@@ -78,29 +94,22 @@ func wrappedCopyPrivateKeyLocal() {
 	_, err := os.Stat("cp.pem")
 	if os.IsNotExist(err) {
 		// The private key file does not exist.
-		fmt.Printf("[err][admin] \"cp.pem\" does not exist in this directory; generate private key first [%s]\n", cts())
+		logErrorf("\"cp.pem\" does not exist in this directory; generate private key first")
 		return
 	}
 
 	// Check if a key already exists at destination directory.
 	if _, err := os.Stat(os.Getenv("LOCAL_CP_API_PK_PATH")); !os.IsNotExist(err) {
 		// Prompt the user.
-		fmt.Printf("Local private key already exists at %s. Do you want to overwrite it? (y/n): ", os.Getenv("LOCAL_CP_API_PK_PATH"))
-		reader := bufio.NewReader(os.Stdin)
-		// Reads until the first occurrence of newline delimiter.
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("[err][admin] reading user input: %v [%s]\n", err, cts())
-			os.Exit(1)
-		}
+		input := promptLine(fmt.Sprintf("Local private key already exists at %s. Do you want to overwrite it? (y/n): ", os.Getenv("LOCAL_CP_API_PK_PATH")))
 
 		// If yes, proceed with key copy.
-		if input == "y\n" || input == "Y\n" {
+		if input == "y" || input == "Y" {
 			copyPrivateKeyLocal()
 			return
 		} else {
 			// If no, print message and return.
-			fmt.Printf("[admin] user declined to delete existing private key in cp-api directory [%s]\n", cts())
+			logInfof("user declined to delete existing private key in cp-api directory")
 			return
 		}
 	}
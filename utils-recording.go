@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session file every cp-api exchange is appended to, set from -record.
+// Empty disables recording.
+var recordPath string
+
+// Serializes appends to the session file across concurrent requests.
+var recordMu sync.Mutex
+
+// One recorded cp-api request and its response. Secret headers and body
+// fields (tokens, login codes, passwords, keys) are redacted like the debug
+// dump; the rest of each body is kept verbatim so failures can be reproduced.
+type recordedExchange struct {
+	Ts              time.Time   `json:"ts"`
+	Method          string      `json:"method"`
+	Url             string      `json:"url"`
+	RequestHeaders  http.Header `json:"requestHeaders"`
+	RequestBody     string      `json:"requestBody,omitempty"`
+	Status          int         `json:"status,omitempty"`
+	ResponseHeaders http.Header `json:"responseHeaders,omitempty"`
+	ResponseBody    string      `json:"responseBody,omitempty"`
+	DurationMs      int64       `json:"durationMs"`
+	// Transport error, if the request got no response.
+	Error string `json:"error,omitempty"`
+}
+
+// Returns a copy of h with secret header values replaced.
+func redactHeaders(h http.Header) http.Header {
+	redactedHeader := h.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := redactedHeader[http.CanonicalHeaderKey(name)]; ok {
+			redactedHeader.Set(name, redacted)
+		}
+	}
+	return redactedHeader
+}
+
+// Reads all of *body and replaces it with an unread copy.
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// RoundTripper appending each exchange to the session file at recordPath,
+// when one is set.
+type recordingTransport struct {
+	next http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if recordPath == "" {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	reqBody, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	exchange := recordedExchange{
+		Ts:             time.Now().UTC(),
+		Method:         req.Method,
+		Url:            req.URL.String(),
+		RequestHeaders: redactHeaders(req.Header),
+		RequestBody:    string(redactFields(reqBody)),
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+	} else {
+		resBody, readErr := drainBody(&res.Body)
+		if readErr != nil {
+			exchange.Error = "reading response body: " + readErr.Error()
+		}
+		exchange.Status = res.StatusCode
+		exchange.ResponseHeaders = redactHeaders(res.Header)
+		exchange.ResponseBody = string(redactFields(resBody))
+	}
+	exchange.DurationMs = time.Since(start).Milliseconds()
+
+	if writeErr := appendRecording(recordPath, exchange); writeErr != nil {
+		logErrorf("writing session recording: %v", writeErr)
+	}
+	return res, err
+}
+
+func appendRecording(path string, exchange recordedExchange) error {
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Reads every exchange in a session file, oldest first.
+func readRecording(path string) ([]recordedExchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exchanges []recordedExchange
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e recordedExchange
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, scanner.Err()
+}
+
+// Returns the path and query of a recorded URL.
+func recordedPath(rawUrl string) string {
+	u, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return u.RequestURI()
+}
+
+func printRecordingIndex(exchanges []recordedExchange) {
+	fmt.Printf("%-4s %-20s %-7s %-40s %-6s %s\n", "#", "TIME", "METHOD", "PATH", "STATUS", "MS")
+	for i, e := range exchanges {
+		status := strconv.Itoa(e.Status)
+		if e.Error != "" {
+			status = "[err]"
+		}
+		fmt.Printf("%-4d %-20s %-7s %-40s %-6s %d\n", i+1, e.Ts.Format("2006-01-02 15:04:05"), e.Method, truncate(recordedPath(e.Url), 40), status, e.DurationMs)
+	}
+}
+
+// Pretty-prints a JSON body, or returns it unchanged if it isn't JSON.
+func formatBody(body string) string {
+	var b bytes.Buffer
+	if json.Indent(&b, []byte(body), "", "  ") != nil {
+		return body
+	}
+	return b.String()
+}
+
+func printHeaders(prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s %s: %s\n", prefix, name, strings.Join(h[name], ", "))
+	}
+}
+
+func printExchange(e recordedExchange) {
+	fmt.Printf("%s %s\n", e.Method, e.Url)
+	fmt.Printf("at %s, took %dms\n", e.Ts.Format(time.RFC3339), e.DurationMs)
+	printHeaders(">", e.RequestHeaders)
+	if e.RequestBody != "" {
+		fmt.Println(formatBody(e.RequestBody))
+	}
+	if e.Error != "" {
+		fmt.Printf("[err] %s\n", e.Error)
+	}
+	if e.Status != 0 {
+		fmt.Printf("< %d %s\n", e.Status, http.StatusText(e.Status))
+		printHeaders("<", e.ResponseHeaders)
+		fmt.Println(formatBody(e.ResponseBody))
+	}
+}
+
+// Prompts for a session file and reads it.
+func promptRecording() ([]recordedExchange, bool) {
+	def := recordPath
+	if def == "" {
+		def = "session.jsonl"
+	}
+	path := promptWithDefault("Session file", def)
+	exchanges, err := readRecording(path)
+	if err != nil {
+		logErrorf("reading session: %v", err)
+		return nil, false
+	}
+	if len(exchanges) == 0 {
+		logInfof("no exchanges recorded in %s", path)
+		return nil, false
+	}
+	return exchanges, true
+}
+
+// Parses a 1-based exchange number.
+func exchangeIndex(input string, exchanges []recordedExchange) (int, error) {
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(exchanges) {
+		return 0, fmt.Errorf("no exchange %q (1-%d)", input, len(exchanges))
+	}
+	return n - 1, nil
+}
+
+// Lists the exchanges in a session file and shows any in full.
+func browseRecording() {
+	exchanges, ok := promptRecording()
+	if !ok {
+		return
+	}
+	for {
+		printRecordingIndex(exchanges)
+		input := promptLine("Exchange # to show (blank to return): ")
+		if input == "" {
+			return
+		}
+		i, err := exchangeIndex(input, exchanges)
+		if err != nil {
+			logErrorf("%v", err)
+			continue
+		}
+		printExchange(exchanges[i])
+	}
+}
+
+// Re-sends a recorded request to baseUrl. Redacted credentials are replaced:
+// admin requests are signed by the acting admin, and bearerToken (if any)
+// is sent in place of a recorded Authorization header. Redacted body fields
+// are sent as recorded, so replaying a login exchange will be rejected.
+func replayExchange(e recordedExchange, baseUrl string, bearerToken string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(e.Method, baseUrl+recordedPath(e.Url), strings.NewReader(e.RequestBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range e.RequestHeaders {
+		if values[0] == redacted {
+			continue
+		}
+		// Transport-managed headers are recomputed for the new request.
+		switch name {
+		case "Content-Length", "Accept-Encoding", "User-Agent", requestIdHeader:
+			continue
+		}
+		req.Header[name] = values
+	}
+	if _, ok := e.RequestHeaders["Admin-Authorization"]; ok {
+		setAdminHeaders(req)
+	}
+	if _, ok := e.RequestHeaders["Authorization"]; ok && bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	res, err := apiClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	return res, body, err
+}
+
+// Re-sends a recorded request against the active or another environment and
+// compares the response with the recorded one.
+func replayRecordedRequest() {
+	exchanges, ok := promptRecording()
+	if !ok {
+		return
+	}
+	printRecordingIndex(exchanges)
+	i, err := exchangeIndex(promptLine("Exchange # to replay: "), exchanges)
+	if err != nil {
+		logErrorf("%v", err)
+		return
+	}
+	e := exchanges[i]
+
+	target := promptWithDefault("Replay against (profile name or base URL)", activeProfile)
+	baseUrl, known := profileBaseUrl(target)
+	if target == activeProfile {
+		baseUrl = apiBaseUrl
+	} else if !known {
+		baseUrl = strings.TrimSuffix(target, "/")
+	}
+	bearerToken := ""
+	if _, ok := e.RequestHeaders["Authorization"]; ok {
+		bearerToken = promptWithDefault("Bearer token to send (recorded one was redacted)", activeSessionToken())
+	}
+
+	if e.Method != http.MethodGet {
+		if dryRunSkip("replay %s %s against %s", e.Method, recordedPath(e.Url), baseUrl) {
+			return
+		}
+		// Whatever was typed, a URL on production's host needs the
+		// production confirmation.
+		request := e.Method + " " + recordedPath(e.Url)
+		if isProductionUrl(baseUrl) && !confirmDestructiveOn("replay "+request, "production", request) {
+			return
+		}
+	}
+
+	res, body, err := replayExchange(e, baseUrl, bearerToken)
+	if err != nil {
+		logErrorf("replaying request: %v", err)
+		return
+	}
+	fmt.Printf("recorded: %d %s\n", e.Status, formatBody(e.ResponseBody))
+	fmt.Printf("replayed: %d %s\n", res.StatusCode, formatBody(string(body)))
+	// Secret fields were redacted when recording, so compare them redacted.
+	if res.StatusCode == e.Status && string(redactFields(body)) == e.ResponseBody {
+		logInfof("replay against %s matched the recording", baseUrl)
+	} else {
+		logWarnf("replay against %s differs from the recording", baseUrl)
+	}
+}
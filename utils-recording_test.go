@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Records cp-api exchanges to a temporary session file for a test.
+func withRecording(t *testing.T) string {
+	t.Helper()
+	old := recordPath
+	t.Cleanup(func() { recordPath = old })
+	recordPath = filepath.Join(t.TempDir(), "session.jsonl")
+	return recordPath
+}
+
+func TestRecordingTransport(t *testing.T) {
+	newFakeApi(t)
+	path := withRecording(t)
+	userId, _ := loginNewUser(t)
+
+	exchanges, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range exchanges {
+		paths = append(paths, e.Method+" "+recordedPath(e.Url))
+	}
+	want := []string{
+		"POST /api/user/signup/",
+		"POST /api/user/login/",
+		"GET /api/admin/bypass-email/" + userId,
+		"POST /api/user/login-code/",
+	}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("recorded:\n%s\nwant:\n%s", strings.Join(paths, "\n"), strings.Join(want, "\n"))
+	}
+
+	signupExchange, bypass := exchanges[0], exchanges[2]
+	if signupExchange.Status != 201 || !strings.Contains(signupExchange.RequestBody, `"email"`) || !strings.Contains(signupExchange.ResponseBody, userId) {
+		t.Errorf("signup exchange = %+v", signupExchange)
+	}
+	if got := bypass.RequestHeaders.Get("Admin-Authorization"); got != redacted {
+		t.Errorf("admin header recorded as %q", got)
+	}
+	if bypass.RequestHeaders.Get(requestIdHeader) == "" {
+		t.Error("request id not recorded")
+	}
+}
+
+func TestRecordingRedactsSecretFields(t *testing.T) {
+	f := newFakeApi(t)
+	path := withRecording(t)
+	userId, token := loginNewUser(t)
+	code := strconv.Itoa(f.users[userId].LoginCode)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{`"code":` + code, `"loginCode":` + code, token} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("recording leaks %q", secret)
+		}
+	}
+	exchanges, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loginCode := exchanges[3]; !strings.Contains(loginCode.RequestBody, userId) || !strings.Contains(loginCode.ResponseBody, `"token":"REDACTED"`) {
+		t.Errorf("login-code exchange = %+v", loginCode)
+	}
+}
+
+func TestReplayExchange(t *testing.T) {
+	f := newFakeApi(t)
+	path := withRecording(t)
+	userId, _ := loginNewUser(t)
+	exchanges, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordPath = ""
+
+	// The admin signature was redacted, so replay must sign afresh.
+	bypass := exchanges[2]
+	res, body, err := replayExchange(bypass, f.server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != bypass.Status || string(redactFields(body)) != bypass.ResponseBody {
+		t.Errorf("replayed %d %s, recorded %d %s", res.StatusCode, body, bypass.Status, bypass.ResponseBody)
+	}
+
+	res, body, err = replayExchange(exchanges[0], f.server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) == exchanges[0].ResponseBody || strings.Contains(string(body), userId) {
+		t.Errorf("replayed duplicate signup got %d %s", res.StatusCode, body)
+	}
+}
+
+func TestBrowseRecording(t *testing.T) {
+	newFakeApi(t)
+	path := withRecording(t)
+	loginNewUser(t)
+
+	withInput(t, path, "3", "")
+	out := captureOutput(t, browseRecording)
+	for _, want := range []string{"/api/admin/bypass-email/", "> Admin-Authorization: REDACTED", "< 200 OK", `"loginCode"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReplayConfirmsProductionUrl(t *testing.T) {
+	f := newFakeApi(t)
+	withGuards(t, "local", false)
+	path := withRecording(t)
+	signup("a@email.com")
+	recordPath = ""
+	// The fake stands in for production, typed as a URL rather than a name.
+	t.Setenv("PRODUCTION_API_BASE_URL", f.server.URL)
+
+	withInput(t, path, "1", f.server.URL+"/", "no")
+	out := captureOutput(t, replayRecordedRequest)
+	if len(f.users) != 1 || !strings.Contains(out, "on production") || !strings.Contains(out, "cancelled") {
+		t.Errorf("unconfirmed replay against production: %d users\n%s", len(f.users), out)
+	}
+
+	withInput(t, path, "1", f.server.URL, "POST /api/user/signup/", "production")
+	if out := captureOutput(t, replayRecordedRequest); !strings.Contains(out, "replayed:") {
+		t.Errorf("confirmed replay not sent:\n%s", out)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File REPL input is saved to, so history survives restarts.
+var replHistoryPath = ".cp-admin-history"
+
+// Number of history entries :history shows.
+const replHistoryShown = 20
+
+const replHelp = `Requests:   METHOD /path [JSON body], e.g.
+              GET /api/exims
+              POST /api/exim/create/ {"title": "..."}
+              GET /api/admin/bypass-email/{{userId}}
+Variables:  {{userId}} {{token}} {{eximId}} {{email}} {{loginCode}} and any set with :set.
+            userId, token, eximId and email belong to the active test user and
+            are updated from responses; a signup adds a new test user.
+Commands:   :vars             show variables
+            :set NAME VALUE   set a variable
+            :auth MODE        auto (default), bearer, admin or none
+            :history          show recent requests
+            !N                repeat history entry N
+            :help             show this help
+            :quit             return to the menu`
+
+var replVarPattern = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// State of an API explorer session.
+type replSession struct {
+	// Variables set with :set or captured from responses that don't belong to
+	// a test user (loginCode); the rest come from the active test user.
+	vars    map[string]string
+	auth    string
+	history []string
+}
+
+func newReplSession() *replSession {
+	return &replSession{vars: make(map[string]string), auth: "auto", history: readReplHistory()}
+}
+
+func readReplHistory() []string {
+	f, err := os.Open(replHistoryPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var history []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+	}
+	return history
+}
+
+func (s *replSession) addHistory(line string) {
+	s.history = append(s.history, line)
+	f, err := os.OpenFile(replHistoryPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		logWarnf("saving history: %v", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// Returns the variables available for substitution.
+func (s *replSession) variables() map[string]string {
+	vars := make(map[string]string)
+	if store, err := loadSessionStore(); err == nil && store.active() != nil {
+		u := store.active()
+		vars["userId"] = u.UserId
+		vars["token"] = u.Token
+		vars["email"] = u.Email
+		if len(u.Exims) > 0 {
+			vars["eximId"] = u.Exims[len(u.Exims)-1]
+		}
+	}
+	for name, value := range s.vars {
+		vars[name] = value
+	}
+	return vars
+}
+
+// Replaces {{name}} references in text, failing on unknown or empty ones.
+func substituteVars(text string, vars map[string]string) (string, error) {
+	var missing []string
+	out := replVarPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		name := replVarPattern.FindStringSubmatch(ref)[1]
+		value, ok := vars[name]
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value for %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// Splits "METHOD /path [body]" into its parts, checking the body is JSON.
+func parseReplRequest(line string) (string, string, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "/") {
+		return "", "", "", fmt.Errorf("expected METHOD /path [JSON body], got %q", line)
+	}
+	method := strings.ToUpper(fields[0])
+	switch method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE", "HEAD":
+	default:
+		return "", "", "", fmt.Errorf("unknown method %q", fields[0])
+	}
+	body := ""
+	if len(fields) == 3 {
+		body = strings.TrimSpace(fields[2])
+		if !json.Valid([]byte(body)) {
+			return "", "", "", fmt.Errorf("body is not valid JSON")
+		}
+	}
+	return method, fields[1], body, nil
+}
+
+// Sets the auth header for a request according to the session's auth mode.
+// In auto mode admin endpoints are signed and others carry the current
+// user's token, if any.
+func (s *replSession) authorize(req *http.Request) {
+	token := activeSessionToken()
+	mode := s.auth
+	if mode == "auto" {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/api/admin/"):
+			mode = "admin"
+		case token != "":
+			mode = "bearer"
+		}
+	}
+	switch mode {
+	case "admin":
+		setAdminHeaders(req)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// Picks up the ids a response hands out so later requests and menu commands
+// can refer to them. A userId for a request email not in the session store
+// (a signup) adds a test user and makes them active. Only exims created with
+// POST /api/exim/create/ are recorded as the user's.
+func (s *replSession) capture(method string, path string, reqBody string, resBody []byte) {
+	var res map[string]interface{}
+	if json.Unmarshal(resBody, &res) != nil {
+		return
+	}
+	if v, ok := res["loginCode"].(float64); ok && v != 0 {
+		s.vars["loginCode"] = strconv.Itoa(int(v))
+	}
+	store, err := loadSessionStore()
+	if err != nil {
+		logWarnf("loading sessions: %v", err)
+		return
+	}
+	u := store.active()
+	if v, ok := res["userId"].(string); ok && v != "" {
+		var req map[string]interface{}
+		json.Unmarshal([]byte(reqBody), &req)
+		if email, ok := req["email"].(string); ok {
+			if u = store.findEmail(email); u == nil {
+				if u, err = store.add("", email); err != nil {
+					logWarnf("adding test user: %v", err)
+					return
+				}
+			}
+			store.Active = u.Name
+		}
+		if u != nil {
+			u.UserId = v
+		}
+	}
+	if u == nil {
+		return
+	}
+	if v, ok := res["token"].(string); ok && v != "" {
+		u.Token = v
+		u.LoggedInTs = time.Now().UTC()
+	}
+	if v, ok := res["eximId"].(string); ok && v != "" && method == "POST" && path == "/api/exim/create/" {
+		u.Exims = append(u.Exims, v)
+	}
+	saveSessionStoreOrLog(store)
+}
+
+// Sends one request line, printing the response.
+func (s *replSession) send(line string) error {
+	line, err := substituteVars(line, s.variables())
+	if err != nil {
+		return err
+	}
+	method, path, body, err := parseReplRequest(line)
+	if err != nil {
+		return err
+	}
+	if method != "GET" && method != "HEAD" {
+		if dryRunSkip("send %s %s", method, path) {
+			return nil
+		}
+		// confirmDestructive adds the production check to the typed request.
+		request := method + " " + path
+		if activeProfile == "production" && !confirmDestructive("send "+request, request) {
+			return nil
+		}
+	}
+
+	req, err := http.NewRequest(method, apiBaseUrl+path, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	s.authorize(req)
+
+	start := time.Now()
+	res, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("<- %s (%s)\n", res.Status, time.Since(start).Round(time.Millisecond))
+	if len(resBody) > 0 {
+		fmt.Println(formatBody(string(resBody)))
+	}
+	if res.StatusCode < 300 {
+		s.capture(method, req.URL.Path, body, resBody)
+	}
+	if method != "GET" && method != "HEAD" {
+		var result error
+		if res.StatusCode >= 300 {
+			result = fmt.Errorf("%s", res.Status)
+		}
+		auditAction(fmt.Sprintf("repl %s %s", method, req.URL.Path), nil, result)
+	}
+	return nil
+}
+
+// Runs a :command, returning false when the REPL should exit.
+func (s *replSession) command(line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help":
+		fmt.Println(replHelp)
+	case ":vars":
+		vars := s.variables()
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-12s %s\n", name, vars[name])
+		}
+	case ":set":
+		if len(fields) < 3 {
+			logErrorf("usage: :set NAME VALUE")
+			break
+		}
+		s.vars[fields[1]] = strings.Join(fields[2:], " ")
+	case ":auth":
+		if len(fields) != 2 || !strings.Contains(" auto bearer admin none ", " "+fields[1]+" ") {
+			logErrorf("usage: :auth auto|bearer|admin|none")
+			break
+		}
+		s.auth = fields[1]
+	case ":history":
+		start := len(s.history) - replHistoryShown
+		if start < 0 {
+			start = 0
+		}
+		for i := start; i < len(s.history); i++ {
+			fmt.Printf("%4d  %s\n", i+1, s.history[i])
+		}
+	default:
+		logErrorf("unknown command %s (see :help)", fields[0])
+	}
+	return true
+}
+
+// Reads request lines and commands until :quit, sending requests to the
+// active profile's API server.
+func apiExplorer() {
+	s := newReplSession()
+	fmt.Printf("cp-api explorer on %s (%s); :help for help, :quit to return\n", activeProfile, apiBaseUrl)
+	for {
+		line := promptLine("api> ")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			if !s.command(line) {
+				return
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(s.history) {
+				logErrorf("no history entry %s", line[1:])
+				continue
+			}
+			line = s.history[n-1]
+			fmt.Printf("api> %s\n", line)
+		}
+		s.addHistory(line)
+		if err := s.send(line); err != nil {
+			logErrorf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReplRequest(t *testing.T) {
+	method, path, body, err := parseReplRequest(`post /api/exim/create/ {"title": "a b"}`)
+	if err != nil || method != "POST" || path != "/api/exim/create/" || body != `{"title": "a b"}` {
+		t.Errorf("got %q %q %q %v", method, path, body, err)
+	}
+	for _, line := range []string{"GET", "GET api/exims", "FETCH /api/exims", `POST /api/user/login/ {"email":`} {
+		if _, _, _, err := parseReplRequest(line); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+func TestSubstituteVars(t *testing.T) {
+	vars := map[string]string{"userId": "u1", "token": ""}
+	got, err := substituteVars("GET /api/admin/bypass-email/{{userId}}", vars)
+	if err != nil || got != "GET /api/admin/bypass-email/u1" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := substituteVars("{{token}} {{nope}}", vars); err == nil || err.Error() != "no value for token, nope" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestApiExplorer(t *testing.T) {
+	f := newFakeApi(t)
+	resetTestUser(t)
+	old := replHistoryPath
+	t.Cleanup(func() { replHistoryPath = old })
+	replHistoryPath = filepath.Join(t.TempDir(), "history")
+	_, otherToken := loginNewUser(t)
+	otherExim := createExim(otherToken)
+
+	withInput(t,
+		`POST /api/user/signup/ {"email":"repl@email.com"}`,
+		`POST /api/user/login/ {"email":"{{email}}"}`,
+		`GET /api/admin/bypass-email/{{userId}}`,
+		`POST /api/user/login-code/ {"userId":"{{userId}}","code":{{loginCode}}}`,
+		`:set title Hello`,
+		`POST /api/exim/create/ {"title":"{{title}}","target":"t","summary":"s","paragraph1":"p","paragraph2":"","paragraph3":"","link":""}`,
+		`GET /api/exim/{{eximId}}`,
+		`!6`,
+		`GET /api/exim/{{missing}}`,
+		`GET /api/exim/`+otherExim,
+		`:history`,
+		`:quit`,
+	)
+	out := captureOutput(t, apiExplorer)
+
+	u := activeTestUser(t)
+	if u.Email != "repl@email.com" || u.UserId == "" || u.Token == "" || len(u.Exims) != 1 {
+		t.Fatalf("session vars not captured: %+v\n%s", u, out)
+	}
+	if f.exims[u.Exims[0]] == nil || f.exims[u.Exims[0]].Title != "Hello" {
+		t.Errorf("exim not created with the bearer token:\n%s", out)
+	}
+	for _, want := range []string{"<- 201 Created", `"title": "Hello"`, "no value for missing", "   7  GET /api/exim/{{eximId}}"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, `"title": "Hello"`) != 2 {
+		t.Errorf("history entry not repeated:\n%s", out)
+	}
+
+	history, err := os.ReadFile(replHistoryPath)
+	if err != nil || strings.Count(string(history), "\n") != 9 {
+		t.Errorf("history file = %q, %v", history, err)
+	}
+}
+
+func TestApiExplorerConfirmsOnProduction(t *testing.T) {
+	f := newFakeApi(t)
+	resetTestUser(t)
+	withGuards(t, "production", false)
+	old := replHistoryPath
+	t.Cleanup(func() { replHistoryPath = old })
+	replHistoryPath = filepath.Join(t.TempDir(), "history")
+
+	withInput(t,
+		`POST /api/user/signup/ {"email":"a@email.com"}`, "no",
+		`POST /api/user/signup/ {"email":"b@email.com"}`, "POST /api/user/signup/", "production",
+		`GET /api/exims`,
+		`:quit`,
+	)
+	out := captureOutput(t, apiExplorer)
+	if len(f.users) != 1 || f.emails["b@email.com"] == "" {
+		t.Errorf("signups sent: %v\n%s", f.emails, out)
+	}
+	if !strings.Contains(out, "send POST /api/user/signup/ cancelled") {
+		t.Errorf("output missing cancellation:\n%s", out)
+	}
+}
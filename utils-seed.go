@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Record of everything created by a seed run, written to disk so the data can
+// be inspected or torn down later.
+type seedManifest struct {
+	CreatedAt  time.Time  `json:"createdAt"`
+	ApiBaseUrl string     `json:"apiBaseUrl"`
+	Seed       int64      `json:"seed"`
+	Users      []seedUser `json:"users"`
+}
+
+type seedUser struct {
+	Email  string     `json:"email"`
+	UserId string     `json:"userId"`
+	Token  string     `json:"token"`
+	Exims  []seedExim `json:"exims"`
+}
+
+type seedExim struct {
+	EximId     string `json:"eximId"`
+	Target     string `json:"target"`
+	IsApproved bool   `json:"isApproved"`
+}
+
+// Creates numUsers users (signup + bypass login code), has each author
+// eximsPerUser exims, and approves roughly approveFraction of them.
+func seedDatabase(numUsers int, eximsPerUser int, approveFraction float64) seedManifest {
+	manifest := seedManifest{
+		CreatedAt:  time.Now().UTC(),
+		ApiBaseUrl: apiBaseUrl,
+		Seed:       dataSeed,
+	}
+
+	for i := 0; i < numUsers; i++ {
+		email := generateRandomEmailAddress()
+		if _, err := signup(email); err != nil {
+			continue
+		}
+		userId, err := login(email)
+		if err != nil {
+			continue
+		}
+		code, err := getLoginCodeViaBypass(userId)
+		if err != nil {
+			continue
+		}
+		token, _, err := loginCode(userId, code)
+		if err != nil {
+			continue
+		}
+
+		user := seedUser{Email: email, UserId: userId, Token: token}
+		for j := 0; j < eximsPerUser; j++ {
+			fields := generateEximFields(eximDataTypical)
+			eximId := createEximWithFields(token, fields)
+			if eximId == "" {
+				continue
+			}
+			user.Exims = append(user.Exims, seedExim{EximId: eximId, Target: fields.Target})
+		}
+		manifest.Users = append(manifest.Users, user)
+	}
+
+	approveSeedExims(&manifest, approveFraction)
+	return manifest
+}
+
+// Approves roughly approveFraction of the manifest's exims, marking only
+// those the API server actually approved.
+func approveSeedExims(manifest *seedManifest, approveFraction float64) {
+	for i := range manifest.Users {
+		for j := range manifest.Users[i].Exims {
+			exim := &manifest.Users[i].Exims[j]
+			dataMu.Lock()
+			approve := dataRng.Float64() < approveFraction
+			dataMu.Unlock()
+			if approve && approveExim(exim.EximId) == nil {
+				exim.IsApproved = true
+			}
+		}
+	}
+}
+
+// Writes the manifest as indented JSON to path.
+func writeSeedManifest(manifest seedManifest, path string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Prompts for seed parameters, populates the API server and writes a manifest.
+func runSeedDatabase() {
+	numUsers, err := strconv.Atoi(promptWithDefault("Users", "10"))
+	if err != nil || numUsers < 1 {
+		logErrorf("users must be a positive integer")
+		return
+	}
+	eximsPerUser, err := strconv.Atoi(promptWithDefault("Exims per user", "3"))
+	if err != nil || eximsPerUser < 0 {
+		logErrorf("exims per user must be a non-negative integer")
+		return
+	}
+	approveFraction, err := strconv.ParseFloat(promptWithDefault("Fraction of exims to approve (0-1)", "0.5"), 64)
+	if err != nil || approveFraction < 0 || approveFraction > 1 {
+		logErrorf("approve fraction must be between 0 and 1")
+		return
+	}
+
+	if dryRunSkip("seed %d users with %d exims each", numUsers, eximsPerUser) {
+		return
+	}
+	manifest := seedDatabase(numUsers, eximsPerUser, approveFraction)
+
+	numExims, numApproved := 0, 0
+	for _, user := range manifest.Users {
+		for _, exim := range user.Exims {
+			numExims++
+			if exim.IsApproved {
+				numApproved++
+			}
+		}
+	}
+
+	// Tokens are included, so keep the manifest private (0600).
+	path := fmt.Sprintf("seed-manifest-%s.json", manifest.CreatedAt.Format("20060102-150405"))
+	err = writeSeedManifest(manifest, path)
+	if err != nil {
+		logErrorf("writing seed manifest: %v", err)
+		return
+	}
+	logInfof("seeded %d users, %d exims (%d approved); manifest written to %s", len(manifest.Users), numExims, numApproved, path)
+}
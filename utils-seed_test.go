@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeedDatabase(t *testing.T) {
+	f := newFakeApi(t)
+	manifest := seedDatabase(3, 4, 1)
+	if len(manifest.Users) != 3 {
+		t.Fatalf("users = %d, want 3", len(manifest.Users))
+	}
+	for _, user := range manifest.Users {
+		if f.emails[user.Email] != user.UserId {
+			t.Errorf("user %s not found in fake", user.Email)
+		}
+		if len(user.Exims) != 4 {
+			t.Errorf("user %s has %d exims, want 4", user.Email, len(user.Exims))
+		}
+		for _, exim := range user.Exims {
+			stored, ok := f.exims[exim.EximId]
+			if !ok {
+				t.Fatalf("exim %s not found in fake", exim.EximId)
+			}
+			if stored.Author != user.UserId || stored.Target != exim.Target {
+				t.Errorf("exim %s author/target = %s/%s, want %s/%s", exim.EximId, stored.Author, stored.Target, user.UserId, exim.Target)
+			}
+			if !exim.IsApproved || !stored.IsApproved {
+				t.Errorf("exim %s not approved with fraction 1", exim.EximId)
+			}
+		}
+	}
+}
+
+func TestSeedDatabaseNoApprovals(t *testing.T) {
+	f := newFakeApi(t)
+	seedDatabase(2, 2, 0)
+	for id, e := range f.exims {
+		if e.IsApproved {
+			t.Errorf("exim %s approved with fraction 0", id)
+		}
+	}
+}
+
+func TestApproveSeedEximsDryRun(t *testing.T) {
+	f := newFakeApi(t)
+	manifest := seedDatabase(2, 2, 0)
+	if len(manifest.Users) != 2 || len(f.exims) != 4 {
+		t.Fatalf("seeded %d users, %d exims", len(manifest.Users), len(f.exims))
+	}
+	withGuards(t, "local", true)
+
+	approveSeedExims(&manifest, 1)
+	for _, user := range manifest.Users {
+		for _, exim := range user.Exims {
+			if exim.IsApproved || f.exims[exim.EximId].IsApproved {
+				t.Errorf("exim %s recorded as approved in dry-run mode", exim.EximId)
+			}
+		}
+	}
+}
+
+func TestWriteSeedManifest(t *testing.T) {
+	newFakeApi(t)
+	manifest := seedDatabase(1, 1, 0)
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := writeSeedManifest(manifest, path); err != nil {
+		t.Fatalf("writeSeedManifest: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got seedManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshaling manifest: %v", err)
+	}
+	if got.Users[0].Token == "" || got.Users[0].Exims[0].EximId != manifest.Users[0].Exims[0].EximId {
+		t.Errorf("manifest round trip lost data: %+v", got)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directory holding the local stores of the test users cp-admin acts as
+// against the API, one per profile.
+var sessionStoreDir = "."
+
+// Returns the session store of the active profile, so test users and tokens
+// from one environment are never sent to another.
+func sessionStorePath() string {
+	return filepath.Join(sessionStoreDir, "sessions-"+activeProfile+".json")
+}
+
+// A test user and the state the API gave them.
+type sessionUser struct {
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	UserId string `json:"userId,omitempty"`
+	Token  string `json:"token,omitempty"`
+	// Login code to use instead of fetching one via bypass-email; 0 to fetch.
+	LoginCode  int       `json:"loginCode,omitempty"`
+	LoggedInTs time.Time `json:"loggedInTs,omitempty"`
+	// Ids of the exims created as this user, oldest first.
+	Exims []string `json:"exims,omitempty"`
+}
+
+type sessionStore struct {
+	// Name of the user API commands act as.
+	Active string         `json:"active"`
+	Users  []*sessionUser `json:"users"`
+}
+
+func (s *sessionStore) find(name string) *sessionUser {
+	for _, u := range s.Users {
+		if u.Name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *sessionStore) findEmail(email string) *sessionUser {
+	for _, u := range s.Users {
+		if u.Email == email {
+			return u
+		}
+	}
+	return nil
+}
+
+// Returns the active user, or nil if none is selected.
+func (s *sessionStore) active() *sessionUser {
+	return s.find(s.Active)
+}
+
+// Adds a user under name, or "user-N" if name is empty, and makes them
+// active.
+func (s *sessionStore) add(name string, email string) (*sessionUser, error) {
+	if name == "" {
+		for n := len(s.Users) + 1; name == "" || s.find(name) != nil; n++ {
+			name = "user-" + strconv.Itoa(n)
+		}
+	}
+	if !adminNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("user name %q must be lowercase letters, digits and dashes", name)
+	}
+	if s.find(name) != nil {
+		return nil, fmt.Errorf("user %q already exists", name)
+	}
+	if !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("%q is not an email address", email)
+	}
+	if s.findEmail(email) != nil {
+		return nil, fmt.Errorf("a user with email %s already exists", email)
+	}
+	u := &sessionUser{Name: name, Email: email}
+	s.Users = append(s.Users, u)
+	s.Active = name
+	return u, nil
+}
+
+func (s *sessionStore) remove(name string) {
+	for i, u := range s.Users {
+		if u.Name == name {
+			s.Users = append(s.Users[:i], s.Users[i+1:]...)
+			break
+		}
+	}
+	if s.Active == name {
+		s.Active = ""
+	}
+}
+
+// Reads the session store. A missing store is empty.
+func loadSessionStore() (*sessionStore, error) {
+	store := &sessionStore{}
+	data, err := os.ReadFile(sessionStorePath())
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", sessionStorePath(), err)
+	}
+	return store, nil
+}
+
+// Writes the session store, which holds live tokens, readable only by the
+// owner.
+func saveSessionStore(store *sessionStore) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sessionStorePath(), append(data, '\n'), 0600)
+}
+
+func saveSessionStoreOrLog(store *sessionStore) {
+	if err := saveSessionStore(store); err != nil {
+		logErrorf("saving sessions: %v", err)
+	}
+}
+
+// Loads the session store and its active user, logging why if there is none.
+func loadActiveUser() (*sessionStore, *sessionUser, bool) {
+	store, err := loadSessionStore()
+	if err != nil {
+		logErrorf("loading sessions: %v", err)
+		return nil, nil, false
+	}
+	u := store.active()
+	if u == nil {
+		logErrorf("no active test user - signup a new user or pick one in Manage Test Users")
+		return nil, nil, false
+	}
+	return store, u, true
+}
+
+// Returns the active user's token, or "" if there is none.
+func activeSessionToken() string {
+	store, err := loadSessionStore()
+	if err != nil || store.active() == nil {
+		return ""
+	}
+	return store.active().Token
+}
+
+// Logs u in (again), fetching a login code via bypass-email unless one is
+// set, and stores the new token.
+func loginSessionUser(u *sessionUser) error {
+	userId, err := login(u.Email)
+	if err != nil {
+		return err
+	}
+	u.UserId = userId
+	code := u.LoginCode
+	if code == 0 {
+		code, err = getLoginCodeViaBypass(userId)
+		if err != nil {
+			return err
+		}
+	}
+	token, attempts, err := loginCode(userId, code)
+	if err != nil {
+		return fmt.Errorf("%v (remaining attempts: %d)", err, attempts)
+	}
+	u.Token = token
+	u.LoggedInTs = time.Now().UTC()
+	return nil
+}
+
+func printSessionUsers(store *sessionStore) {
+	fmt.Printf("%-4s %-14s %-32s %-28s %-8s %s\n", "#", "NAME", "EMAIL", "USER ID", "TOKEN", "EXIMS")
+	for i, u := range store.Users {
+		token := "-"
+		if u.Token != "" {
+			token = "yes"
+		}
+		name := u.Name
+		if u.Name == store.Active {
+			name += " *"
+		}
+		fmt.Printf("%-4d %-14s %-32s %-28s %-8s %d\n", i+1, name, truncate(u.Email, 32), u.UserId, token, len(u.Exims))
+	}
+	if len(store.Users) == 0 {
+		fmt.Println("(no test users yet)")
+	}
+}
+
+// Resolves a user typed as a list number or name.
+func pickSessionUser(store *sessionStore, input string) *sessionUser {
+	if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(store.Users) {
+		return store.Users[n-1]
+	}
+	return store.find(input)
+}
+
+// Lists the stored test users and lets one be made active, logged in (or
+// refreshed), added with a known email, or removed.
+func manageSessionUsers() {
+	for {
+		store, err := loadSessionStore()
+		if err != nil {
+			logErrorf("loading sessions: %v", err)
+			return
+		}
+		fmt.Println()
+		printSessionUsers(store)
+		action := promptLine("s switch active, l log in/refresh, a add existing user, n sign up new, x remove, q quit: ")
+
+		switch action {
+		case "q", "":
+			return
+		case "n":
+			wrappedSignup()
+			continue
+		case "a":
+			email := promptLine("Email: ")
+			name := promptLine("Name (blank for automatic): ")
+			if _, err := store.add(name, email); err != nil {
+				logErrorf("%v", err)
+				continue
+			}
+			saveSessionStoreOrLog(store)
+			continue
+		case "s", "l", "x":
+		default:
+			logErrorf("unknown action %q", action)
+			continue
+		}
+
+		u := pickSessionUser(store, promptLine("User # or name: "))
+		if u == nil {
+			logErrorf("no such user")
+			continue
+		}
+		switch action {
+		case "s":
+			store.Active = u.Name
+			logInfof("now acting as test user %s (%s)", u.Name, u.Email)
+		case "l":
+			if err := loginSessionUser(u); err != nil {
+				logErrorf("logging in %s: %v", u.Name, err)
+				continue
+			}
+			logInfof("logged in %s (userId %s)", u.Name, u.UserId)
+		case "x":
+			store.remove(u.Name)
+			logInfof("removed %s from local sessions (the account on the api server is untouched)", u.Name)
+		}
+		saveSessionStoreOrLog(store)
+	}
+}
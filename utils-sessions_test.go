@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionStoreAdd(t *testing.T) {
+	store := &sessionStore{}
+	u, err := store.add("", "a@email.com")
+	if err != nil || u.Name != "user-1" || store.Active != "user-1" {
+		t.Fatalf("add = %+v, %v (active %q)", u, err, store.Active)
+	}
+	if _, err := store.add("bob", "b@email.com"); err != nil || store.Active != "bob" {
+		t.Fatalf("add bob: %v (active %q)", err, store.Active)
+	}
+	if u, _ := store.add("", "c@email.com"); u.Name != "user-3" {
+		t.Errorf("automatic name = %q, want user-3", u.Name)
+	}
+	for _, tt := range []struct{ name, email string }{
+		{"bob", "d@email.com"},
+		{"Bad Name", "d@email.com"},
+		{"", "a@email.com"},
+		{"", "not-an-email"},
+	} {
+		if _, err := store.add(tt.name, tt.email); err == nil {
+			t.Errorf("add(%q, %q): expected error", tt.name, tt.email)
+		}
+	}
+
+	store.remove("bob")
+	if store.find("bob") != nil || store.Active != "user-3" || len(store.Users) != 2 {
+		t.Errorf("after remove: %+v", store)
+	}
+	store.remove("user-3")
+	if store.Active != "" || store.active() != nil {
+		t.Errorf("removing the active user left %q active", store.Active)
+	}
+}
+
+func TestSessionStorePersists(t *testing.T) {
+	resetTestUser(t)
+	store, err := loadSessionStore()
+	if err != nil || len(store.Users) != 0 {
+		t.Fatalf("missing store = %+v, %v", store, err)
+	}
+	u, _ := store.add("alice", "alice@email.com")
+	u.Token = "secret"
+	if err := saveSessionStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(sessionStorePath()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("store mode = %v, %v", info.Mode(), err)
+	}
+	if got := activeSessionToken(); got != "secret" {
+		t.Errorf("activeSessionToken = %q", got)
+	}
+}
+
+func TestSessionStorePerProfile(t *testing.T) {
+	resetTestUser(t)
+	withGuards(t, "local", false)
+	store, _ := loadSessionStore()
+	u, _ := store.add("alice", "alice@email.com")
+	u.Token = "local-token"
+	saveSessionStore(store)
+
+	activeProfile = "production"
+	if got := activeSessionToken(); got != "" {
+		t.Errorf("production sees local token %q", got)
+	}
+	if filepath.Base(sessionStorePath()) != "sessions-production.json" {
+		t.Errorf("production store = %s", sessionStorePath())
+	}
+	activeProfile = "local"
+	if got := activeSessionToken(); got != "local-token" {
+		t.Errorf("local token = %q", got)
+	}
+}
+
+func TestManageSessionUsers(t *testing.T) {
+	f := newFakeApi(t)
+	resetTestUser(t)
+
+	withInput(t,
+		"n",
+		"n",
+		"a", "known@email.com", "known",
+		"s", "1",
+		"l", "user-1",
+		"x", "known",
+		"q",
+	)
+	out := captureOutput(t, manageSessionUsers)
+
+	store, err := loadSessionStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Users) != 2 || store.find("known") != nil {
+		t.Fatalf("users = %+v\n%s", store.Users, out)
+	}
+	u := activeTestUser(t)
+	if u.Name != "user-1" || u.Token == "" || f.emails[u.Email] != u.UserId {
+		t.Errorf("active user = %+v\n%s", u, out)
+	}
+	if store.find("user-2").Token != "" {
+		t.Errorf("user-2 logged in without being asked")
+	}
+	if !strings.Contains(out, "user-1 *") {
+		t.Errorf("active user not marked:\n%s", out)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval between checks while waiting on the API server to stop or start.
+var shutdownPollInterval = 250 * time.Millisecond
+
+// Reports whether the API server's port is accepting connections.
+type portProbe func() (bool, error)
+
+// Probes the API server at apiBaseUrl directly.
+func localApiProbe() (bool, error) {
+	return portOpen(apiAddr()), nil
+}
+
+// Returns a probe that checks the API port on a remote server over SSH, since
+// cp-api's port is only reachable from the server itself.
+func remoteApiProbe(serverName string) portProbe {
+	return func() (bool, error) {
+		cmd, err := sshCommand(serverName, "nc -z localhost 8000")
+		if err != nil {
+			return false, err
+		}
+		return remoteProbeResult(cmd.Run())
+	}
+}
+
+// Interprets the result of running nc over SSH. nc exits 1 when nothing is
+// listening; ssh itself exits 255 when it can't connect, authenticate or
+// verify the host key, which says nothing about the port.
+func remoteProbeResult(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false, err
+	}
+	switch exitErr.ExitCode() {
+	case 1:
+		return false, nil
+	case 255:
+		return false, fmt.Errorf("ssh failed: %v", err)
+	}
+	return false, fmt.Errorf("probing port: %v", err)
+}
+
+// Polls probe until the port stops accepting connections, returning how long
+// that took.
+func waitForPortClosed(probe portProbe, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	for {
+		open, err := probe()
+		if err != nil {
+			return time.Since(start), err
+		}
+		if !open {
+			return time.Since(start), nil
+		}
+		if time.Since(start) > timeout {
+			return time.Since(start), fmt.Errorf("api server still accepting connections after %s", timeout)
+		}
+		time.Sleep(shutdownPollInterval)
+	}
+}
+
+// Polls check until it succeeds, returning its last error on timeout.
+func waitForHealthy(check func() error, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	for {
+		err := check()
+		if err == nil {
+			return time.Since(start), nil
+		}
+		if time.Since(start) > timeout {
+			return time.Since(start), fmt.Errorf("not healthy after %s: %v", timeout, err)
+		}
+		time.Sleep(shutdownPollInterval)
+	}
+}
+
+// Checks that the API server at apiBaseUrl answers a public endpoint.
+func localApiHealthy() error {
+	res, err := apiClient.Get(apiBaseUrl + apiHealthPath)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", apiHealthPath, res.Status)
+	}
+	return nil
+}
+
+// Asks cp-api on a remote server to shut down, via SSH to its local port.
+// Returns errDryRun if the request was skipped.
+func requestRemoteShutdown(serverName string, drain time.Duration) error {
+	path := "/api/admin/shutdown/"
+	if drain > 0 {
+		path += "?drain=" + drain.String()
+	}
+	cmd, err := sshAdminCommand(serverName, remoteAdminCurl("POST", path))
+	if err != nil {
+		return err
+	}
+	if dryRunSkip("run: %s", strings.Join(cmd.Args, " ")) {
+		return errDryRun
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	auditAction("shutdown", map[string]string{"server": serverName, "drain": drain.String()}, err)
+	return err
+}
+
+// Shuts down the API server on target ("local" or a server name) and waits
+// for its port to close, allowing drain plus timeout. Returns the time from
+// the request until the port closed, or errDryRun if the request was skipped.
+func gracefulShutdown(target string, drain time.Duration, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	var err error
+	probe := portProbe(localApiProbe)
+	if target == localSource {
+		err = requestShutdown(apiBaseUrl, drain)
+	} else {
+		err = requestRemoteShutdown(target, drain)
+		probe = remoteApiProbe(target)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := waitForPortClosed(probe, drain+timeout); err != nil {
+		return time.Since(start), err
+	}
+	return time.Since(start), nil
+}
+
+// Restarts cp-api on a remote server through systemd and waits for it to
+// answer requests on its local port again.
+func restartRemote(serverName string, timeout time.Duration) (time.Duration, error) {
+	cmd, err := sshCommand(serverName, "sudo systemctl restart cp-api")
+	if err != nil {
+		return 0, err
+	}
+	if dryRunSkip("run: %s", strings.Join(cmd.Args, " ")) {
+		return 0, errDryRun
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	var elapsed time.Duration
+	err = cmd.Run()
+	if err == nil {
+		elapsed, err = waitForHealthy(func() error {
+			check, err := sshCommand(serverName, "curl -sf -o /dev/null http://localhost:8000"+apiHealthPath)
+			if err != nil {
+				return err
+			}
+			return check.Run()
+		}, timeout)
+	}
+	auditAction("restart api", map[string]string{"server": serverName}, err)
+	return elapsed, err
+}
+
+// Prompts for a target, drain and timeout, shuts the API server down after a
+// typed confirmation and, for remote servers, offers to restart it.
+func wrappedShutdown() {
+	target := promptWithDefault("Shut down api on (local or server name, e.g. cp-1)", localSource)
+	drainSecs, err := strconv.Atoi(promptWithDefault("Seconds to let in-flight requests drain (0 for none)", "0"))
+	if err != nil || drainSecs < 0 {
+		logErrorf("drain must be a non-negative integer")
+		return
+	}
+	timeoutSecs, err := strconv.Atoi(promptWithDefault("Seconds to wait for the port to close", "10"))
+	if err != nil || timeoutSecs < 1 {
+		logErrorf("timeout must be a positive integer")
+		return
+	}
+
+	confirmTarget := target
+	if target == localSource {
+		confirmTarget, _, _ = strings.Cut(apiAddr(), ":")
+	}
+	if !confirmDestructive("shut down the api server", confirmTarget) {
+		return
+	}
+
+	elapsed, err := gracefulShutdown(target, time.Duration(drainSecs)*time.Second, time.Duration(timeoutSecs)*time.Second)
+	if err == errDryRun {
+		return
+	}
+	if err != nil {
+		logErrorf("shutting down api on %s: %v", target, err)
+		return
+	}
+	logInfof("api on %s stopped after %s", target, elapsed.Round(time.Millisecond))
+
+	if target == localSource {
+		return
+	}
+	if promptLine(fmt.Sprintf("Restart cp-api on %s via systemd? (y/n): ", target)) != "y" {
+		return
+	}
+	elapsed, err = restartRemote(target, 30*time.Second)
+	if err != nil {
+		logErrorf("!!! cp-api on %s did NOT come back healthy: %v; check `journalctl -u cp-api` on the server", target, err)
+		return
+	}
+	logInfof("cp-api on %s restarted and healthy after %s", target, elapsed.Round(time.Millisecond))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdownLocal(t *testing.T) {
+	f := newFakeApi(t)
+	f.closeOnShutdown = true
+
+	elapsed, err := gracefulShutdown(localSource, 2*time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("gracefulShutdown: %v", err)
+	}
+	if f.shutdowns != 1 || f.shutdownDrain != "2s" {
+		t.Errorf("shutdowns = %d, drain = %q", f.shutdowns, f.shutdownDrain)
+	}
+	if elapsed <= 0 || elapsed > 3*time.Second {
+		t.Errorf("elapsed = %s", elapsed)
+	}
+	if apiServerOffline() != nil {
+		t.Error("port still open after shutdown")
+	}
+}
+
+func TestGracefulShutdownTimesOut(t *testing.T) {
+	f := newFakeApi(t)
+	// The fake keeps listening, as a server stuck draining would.
+	_, err := gracefulShutdown(localSource, 0, 300*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected timeout while the port stays open")
+	}
+	if f.shutdowns != 1 || f.shutdownDrain != "" {
+		t.Errorf("shutdowns = %d, drain = %q", f.shutdowns, f.shutdownDrain)
+	}
+}
+
+func TestWaitForPortClosedProbeError(t *testing.T) {
+	_, err := waitForPortClosed(func() (bool, error) { return false, fmt.Errorf("ssh failed") }, time.Second)
+	if err == nil || err.Error() != "ssh failed" {
+		t.Errorf("err = %v, want probe error", err)
+	}
+}
+
+func TestRemoteProbeResult(t *testing.T) {
+	exit := func(code int) error {
+		return exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+	}
+	if open, err := remoteProbeResult(nil); !open || err != nil {
+		t.Errorf("success = %v, %v", open, err)
+	}
+	if open, err := remoteProbeResult(exit(1)); open || err != nil {
+		t.Errorf("nc exit 1 = %v, %v; want closed", open, err)
+	}
+	// ssh exits 255 when the server is unreachable or auth fails; that must
+	// not pass for a closed port.
+	for _, code := range []int{255, 2} {
+		if _, err := remoteProbeResult(exit(code)); err == nil {
+			t.Errorf("exit %d: expected error", code)
+		}
+	}
+}
+
+func TestWaitForHealthy(t *testing.T) {
+	f := newFakeApi(t)
+	if _, err := waitForHealthy(localApiHealthy, time.Second); err != nil {
+		t.Errorf("healthy fake reported %v", err)
+	}
+	f.server.Close()
+	if _, err := waitForHealthy(localApiHealthy, 300*time.Millisecond); err == nil {
+		t.Error("expected error from stopped server")
+	}
+}
+
+func TestWrappedShutdownConfirms(t *testing.T) {
+	f := newFakeApi(t)
+	f.closeOnShutdown = true
+	withGuards(t, "local", false)
+	withInput(t,
+		"", "0", "5", "localhost",
+		"local", "1", "5", "127.0.0.1",
+	)
+	wrappedShutdown()
+	if f.shutdowns != 0 {
+		t.Fatal("shutdown ran without confirmation")
+	}
+	wrappedShutdown()
+	if f.shutdowns != 1 || f.shutdownDrain != "1s" {
+		t.Errorf("shutdowns = %d, drain = %q", f.shutdowns, f.shutdownDrain)
+	}
+}
+
+func TestGracefulShutdownDryRun(t *testing.T) {
+	f := newFakeApi(t)
+	withGuards(t, "local", true)
+	withTestServer(t)
+	for _, target := range []string{localSource, "cp-1"} {
+		if _, err := gracefulShutdown(target, 0, time.Second); err != errDryRun {
+			t.Errorf("%s: gracefulShutdown = %v, want errDryRun", target, err)
+		}
+	}
+	if f.shutdowns != 0 {
+		t.Errorf("dry run shut down the fake")
+	}
+}
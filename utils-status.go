@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Public endpoint used to check that cp-api is answering requests.
+const apiHealthPath = "/api/exims"
+
+// Time allowed for each status check.
+var statusTimeout = 5 * time.Second
+
+// TLS settings used to inspect certificates; tests swap in their own roots.
+var statusTLSConfig = &tls.Config{}
+
+// Certificates expiring sooner than this are flagged.
+const certWarnDays = 14
+
+// Reachability of one environment's API server.
+type envStatus struct {
+	Profile string
+	BaseUrl string
+	TcpOpen bool
+	// Status line of the health check, or the error that prevented it.
+	Http    string
+	HttpOk  bool
+	Latency time.Duration
+	// Zero unless the API is served over TLS.
+	CertExpiry time.Time
+	CertErr    error
+}
+
+// State of one Hetzner server from serverMap.
+type serverStatus struct {
+	Name   string
+	Ip     string
+	Status string
+	Uptime time.Duration
+	// Why uptime couldn't be read, if it couldn't.
+	UptimeErr error
+}
+
+// Returns host:port for a base URL, defaulting the port from the scheme.
+func hostPort(baseUrl string) (string, error) {
+	u, err := neturl.Parse(baseUrl)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	}
+	return net.JoinHostPort(u.Hostname(), "80"), nil
+}
+
+// Returns when the TLS certificate served at addr expires.
+func certExpiry(addr string) (time.Time, error) {
+	dialer := &net.Dialer{Timeout: statusTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, statusTLSConfig)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return time.Time{}, fmt.Errorf("no certificate presented")
+	}
+	return certs[0].NotAfter, nil
+}
+
+// Checks TCP reachability, the health endpoint and its latency, and (for
+// https) certificate expiry of the API server at baseUrl.
+func checkEnvStatus(profile string, baseUrl string) envStatus {
+	s := envStatus{Profile: profile, BaseUrl: baseUrl}
+	addr, err := hostPort(baseUrl)
+	if err != nil {
+		s.Http = err.Error()
+		return s
+	}
+	s.TcpOpen = portOpen(addr)
+
+	client := &http.Client{Timeout: statusTimeout, Transport: apiClient.Transport}
+	start := time.Now()
+	res, err := client.Get(baseUrl + apiHealthPath)
+	s.Latency = time.Since(start)
+	if err != nil {
+		s.Http = err.Error()
+	} else {
+		res.Body.Close()
+		s.Http = res.Status
+		s.HttpOk = res.StatusCode == http.StatusOK
+	}
+
+	if strings.HasPrefix(baseUrl, "https://") {
+		s.CertExpiry, s.CertErr = certExpiry(addr)
+	}
+	return s
+}
+
+// Reads a server's uptime from /proc/uptime over SSH, giving up after
+// statusTimeout. BatchMode keeps ssh from waiting on a password or host key
+// prompt.
+func remoteUptime(serverName string) (time.Duration, error) {
+	target, err := sshTarget(serverName)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	connectTimeout := fmt.Sprintf("ConnectTimeout=%d", int(math.Ceil(statusTimeout.Seconds())))
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", "-o", connectTimeout, target, "cat /proc/uptime")
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("no answer within %s", statusTimeout)
+	}
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/uptime output %q", out)
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+func checkServerStatus(server *hcloud.Server) serverStatus {
+	s := serverStatus{Name: server.Name, Status: string(server.Status)}
+	if server.PublicNet.IPv4.IP != nil {
+		s.Ip = server.PublicNet.IPv4.IP.String()
+	}
+	if server.Status == hcloud.ServerStatusRunning {
+		s.Uptime, s.UptimeErr = remoteUptime(server.Name)
+	} else {
+		s.UptimeErr = fmt.Errorf("server is %s", server.Status)
+	}
+	return s
+}
+
+// Formats a duration as e.g. "3d4h" or "12m".
+func formatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, int(d.Hours())%24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
+
+func printStatus(envs []envStatus, servers []serverStatus, now time.Time) {
+	fmt.Printf("--- STATUS as of %s ---\n", now.Format(time.RFC3339))
+	fmt.Printf("%-12s %-32s %-6s %-28s %-9s %s\n", "PROFILE", "API", "TCP", "HEALTH", "LATENCY", "TLS")
+	for _, s := range envs {
+		tcp := "down"
+		if s.TcpOpen {
+			tcp = "up"
+		}
+		cert := "-"
+		if s.CertErr != nil {
+			cert = "[err] " + truncate(s.CertErr.Error(), 40)
+		} else if !s.CertExpiry.IsZero() {
+			days := int(s.CertExpiry.Sub(now).Hours() / 24)
+			cert = fmt.Sprintf("expires in %dd (%s)", days, s.CertExpiry.Format("2006-01-02"))
+			if days < certWarnDays {
+				cert = "[err] " + cert
+			}
+		}
+		health := s.Http
+		if !s.HttpOk {
+			health = "[err] " + health
+		}
+		fmt.Printf("%-12s %-32s %-6s %-28s %-9s %s\n", s.Profile, truncate(s.BaseUrl, 32), tcp, truncate(health, 28), s.Latency.Round(time.Millisecond), cert)
+	}
+
+	if len(servers) == 0 {
+		fmt.Println("(no Hetzner servers known; run Get/Set Current Resources)")
+		return
+	}
+	fmt.Printf("\n%-12s %-16s %-12s %s\n", "SERVER", "IP", "HETZNER", "UPTIME")
+	for _, s := range servers {
+		uptime := formatUptime(s.Uptime)
+		if s.UptimeErr != nil {
+			uptime = "? (" + truncate(s.UptimeErr.Error(), 40) + ")"
+		}
+		fmt.Printf("%-12s %-16s %-12s %s\n", s.Name, s.Ip, s.Status, uptime)
+	}
+}
+
+// Runs every status check concurrently.
+func collectStatus() ([]envStatus, []serverStatus) {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	serverNames := make([]string, 0, len(serverMap))
+	for name := range serverMap {
+		serverNames = append(serverNames, name)
+	}
+	sort.Strings(serverNames)
+
+	envs := make([]envStatus, len(names))
+	servers := make([]serverStatus, len(serverNames))
+	done := make(chan bool)
+	for i, name := range names {
+		i, name := i, name
+		baseUrl, _ := profileBaseUrl(name)
+		if name == activeProfile {
+			baseUrl = apiBaseUrl
+		}
+		go func() {
+			envs[i] = checkEnvStatus(name, baseUrl)
+			done <- true
+		}()
+	}
+	for i, name := range serverNames {
+		i, server := i, serverMap[name]
+		go func() {
+			servers[i] = checkServerStatus(server)
+			done <- true
+		}()
+	}
+	for i := 0; i < len(names)+len(serverNames); i++ {
+		<-done
+	}
+	return envs, servers
+}
+
+// Shows the status of every environment and known server, refreshing in
+// place until Enter is pressed.
+func statusDashboard() {
+	secs, err := strconv.Atoi(promptWithDefault("Refresh every N seconds", "5"))
+	if err != nil || secs < 1 {
+		logErrorf("refresh interval must be a positive integer")
+		return
+	}
+
+	var envs []envStatus
+	var servers []serverStatus
+	refreshUntilEnter(time.Duration(secs)*time.Second,
+		func() { envs, servers = collectStatus() },
+		func() { printStatus(envs, servers, time.Now()) })
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestCheckEnvStatus(t *testing.T) {
+	f := newFakeApi(t)
+	s := checkEnvStatus("test", f.server.URL)
+	if !s.TcpOpen || !s.HttpOk || s.Http != "200 OK" || s.Latency <= 0 || !s.CertExpiry.IsZero() {
+		t.Errorf("status = %+v", s)
+	}
+
+	f.server.Close()
+	s = checkEnvStatus("test", f.server.URL)
+	if s.TcpOpen || s.HttpOk {
+		t.Errorf("stopped server status = %+v", s)
+	}
+}
+
+func TestCheckEnvStatusTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	oldClient, oldTLS := apiClient, statusTLSConfig
+	t.Cleanup(func() { apiClient, statusTLSConfig = oldClient, oldTLS })
+	apiClient = server.Client()
+	statusTLSConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	s := checkEnvStatus("test", server.URL)
+	if s.HttpOk || s.Http != "503 Service Unavailable" {
+		t.Errorf("health = %q ok %v", s.Http, s.HttpOk)
+	}
+	if s.CertErr != nil || !s.CertExpiry.Equal(server.Certificate().NotAfter) {
+		t.Errorf("cert expiry = %v, err %v", s.CertExpiry, s.CertErr)
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	for url, want := range map[string]string{
+		"http://localhost:8000":        "localhost:8000",
+		"https://cooperativeparty.org": "cooperativeparty.org:443",
+		"http://example.com":           "example.com:80",
+	} {
+		if got, err := hostPort(url); err != nil || got != want {
+			t.Errorf("hostPort(%s) = %q, %v; want %q", url, got, err, want)
+		}
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		5 * time.Minute:             "5m",
+		2*time.Hour + 3*time.Minute: "2h3m",
+		50 * time.Hour:              "2d2h",
+	} {
+		if got := formatUptime(d); got != want {
+			t.Errorf("formatUptime(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestRemoteUptimeTimesOut(t *testing.T) {
+	withTestServer(t)
+	// Stand in for an ssh that never gets an answer.
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	old := statusTimeout
+	statusTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { statusTimeout = old })
+
+	start := time.Now()
+	if _, err := remoteUptime("cp-1"); err == nil || !strings.Contains(err.Error(), "no answer within") {
+		t.Errorf("err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("remoteUptime took %s", elapsed)
+	}
+}
+
+func TestCollectStatusHonorsProfileOverrides(t *testing.T) {
+	f := newFakeApi(t)
+	oldServers, oldProfiles := serverMap, profiles
+	t.Cleanup(func() { serverMap, profiles = oldServers, oldProfiles })
+	serverMap = nil
+	profiles = map[string]string{activeProfile: f.server.URL, "staging": "http://127.0.0.1:1"}
+	t.Setenv("STAGING_API_BASE_URL", f.server.URL)
+
+	envs, _ := collectStatus()
+	for _, s := range envs {
+		if s.BaseUrl != f.server.URL || !s.HttpOk {
+			t.Errorf("%s status = %+v", s.Profile, s)
+		}
+	}
+}
+
+func TestStatusDashboard(t *testing.T) {
+	f := newFakeApi(t)
+	oldServers, oldProfiles := serverMap, profiles
+	t.Cleanup(func() { serverMap, profiles = oldServers, oldProfiles })
+	// Keep the dashboard off the network: only the active profile, on the fake.
+	profiles = map[string]string{activeProfile: f.server.URL}
+	serverMap = map[string]*hcloud.Server{
+		"cp-1": {Name: "cp-1", Status: hcloud.ServerStatusOff, PublicNet: hcloud.ServerPublicNet{IPv4: hcloud.ServerPublicNetIPv4{IP: net.ParseIP("192.0.2.1")}}},
+	}
+
+	envs, servers := collectStatus()
+	if len(envs) != len(profiles) || len(servers) != 1 || servers[0].UptimeErr == nil {
+		t.Fatalf("envs = %+v, servers = %+v", envs, servers)
+	}
+	for _, s := range envs {
+		if s.Profile == activeProfile && (s.BaseUrl != f.server.URL || !s.HttpOk) {
+			t.Errorf("active profile status = %+v", s)
+		}
+	}
+
+	withInput(t, "1", "")
+	statusDashboard()
+}
+
+func TestPrintStatusFlagsExpiringCert(t *testing.T) {
+	now := time.Now()
+	out := captureOutput(t, func() {
+		printStatus([]envStatus{{Profile: "production", HttpOk: true, Http: "200 OK", CertExpiry: now.Add(3 * 24 * time.Hour)}}, nil, now)
+	})
+	if !strings.Contains(out, "[err] expires in") {
+		t.Errorf("expiring cert not flagged:\n%s", out)
+	}
+}
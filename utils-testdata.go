@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Seed shared by every generator of test data. It is printed on startup and
+// can be set with -seed so that a failed run can be reproduced exactly.
+var dataSeed int64
+
+// Shared source of randomness for test data. Guarded by dataMu since load
+// tests generate data from many goroutines.
+var dataRng = rand.New(rand.NewSource(time.Now().UnixNano()))
+var dataMu sync.Mutex
+
+// Number of email addresses generated so far in this run.
+var emailCount int
+
+// Exim targets cp-admin generates. Only FEDERAL, the first, is known to be
+// accepted by cp-api and is used for every kind of content but other-target;
+// the rest are cp-admin's own guess.
+var eximTargets = []string{"FEDERAL", "STATE", "COUNTY", "CITY"}
+
+// Field lengths (in characters) cp-admin treats as the limits when
+// generating at- and over-limit exims. These are cp-admin's own guesses, not
+// taken from cp-api's validation; change them once cp-api's are known.
+const (
+	maxEximTitleLen     = 100
+	maxEximSummaryLen   = 500
+	maxEximParagraphLen = 2000
+	maxEximLinkLen      = 500
+)
+
+// Kinds of generated exim content, from well-formed to deliberately invalid.
+const (
+	eximDataTypical    = "typical"
+	eximDataAtLimit    = "at-limit"
+	eximDataOverLimit  = "over-limit"
+	eximDataUnicode    = "unicode"
+	eximDataInvalidUrl = "invalid-url"
+	// Typical content with one of the guessed targets other than FEDERAL.
+	eximDataOtherTarget = "other-target"
+)
+
+var eximDataKinds = []string{eximDataTypical, eximDataAtLimit, eximDataOverLimit, eximDataUnicode, eximDataInvalidUrl, eximDataOtherTarget}
+
+var unicodeWords = []string{"café", "naïve", "mañana", "Straße", "日本語", "中文", "Ελληνικά", "русский", "עברית", "العربية", "हिन्दी", "🎉", "👍🏽", "ﬁle", "é"}
+
+var invalidLinks = []string{
+	"not a url",
+	"https://",
+	"http//missing-colon.com",
+	"https://exa mple.com",
+	"ftp://example.com/file",
+	"javascript:alert(1)",
+	"www.no-scheme.com",
+}
+
+// Fields of an exim as sent to /api/exim/create/.
+type eximFields struct {
+	Target     string `json:"target"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary"`
+	Paragraph1 string `json:"paragraph1"`
+	Paragraph2 string `json:"paragraph2"`
+	Paragraph3 string `json:"paragraph3"`
+	Link       string `json:"link"`
+}
+
+// Reseeds the shared generator. A seed of 0 picks one from the clock.
+func setDataSeed(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	dataSeed = seed
+	dataRng = rand.New(rand.NewSource(seed))
+	emailCount = 0
+}
+
+// Returns one of the guessed targets, never FEDERAL.
+func randomOtherEximTarget() string {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	others := eximTargets[1:]
+	return others[dataRng.Intn(len(others))]
+}
+
+// Returns space separated words from the given list, exactly n characters
+// (runes) long.
+func generateTextOfLength(list []string, n int) string {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	var b strings.Builder
+	length := 0
+	for length < n {
+		if length > 0 {
+			b.WriteString(" ")
+			length++
+		}
+		w := list[dataRng.Intn(len(list))]
+		b.WriteString(w)
+		length += len([]rune(w))
+	}
+	return string([]rune(b.String())[:n])
+}
+
+func generateInvalidLink() string {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	return invalidLinks[dataRng.Intn(len(invalidLinks))]
+}
+
+// Returns a link of exactly n characters.
+func generateLinkOfLength(n int) string {
+	prefix, suffix := "https://", ".com"
+	host := strings.ReplaceAll(generateTextOfLength(words, n-len(prefix)-len(suffix)), " ", "-")
+	return prefix + host + suffix
+}
+
+// Generates exim content of the given kind, targeted at FEDERAL unless the
+// kind is other-target.
+func generateEximFields(kind string) eximFields {
+	e := eximFields{Target: eximTargets[0]}
+	switch kind {
+	case eximDataAtLimit, eximDataOverLimit:
+		extra := 0
+		if kind == eximDataOverLimit {
+			extra = 1
+		}
+		e.Title = generateTextOfLength(words, maxEximTitleLen+extra)
+		e.Summary = generateTextOfLength(words, maxEximSummaryLen+extra)
+		e.Paragraph1 = generateTextOfLength(words, maxEximParagraphLen+extra)
+		e.Paragraph2 = generateTextOfLength(words, maxEximParagraphLen+extra)
+		e.Paragraph3 = generateTextOfLength(words, maxEximParagraphLen+extra)
+		e.Link = generateLinkOfLength(maxEximLinkLen + extra)
+	case eximDataUnicode:
+		e.Title = generateTextOfLength(unicodeWords, 40)
+		e.Summary = generateTextOfLength(unicodeWords, 200)
+		e.Paragraph1 = generateTextOfLength(unicodeWords, 400)
+		e.Paragraph2 = generateTextOfLength(unicodeWords, 400)
+		e.Paragraph3 = generateTextOfLength(unicodeWords, 400)
+		e.Link = fmt.Sprintf("https://%s.com/%s", generatePlaceholderLink(2), strings.ReplaceAll(generateTextOfLength(unicodeWords[:4], 12), " ", "-"))
+	default:
+		e.Title = generatePlaceholderText(5)
+		e.Summary = generatePlaceholderText(20)
+		e.Paragraph1 = generatePlaceholderText(40)
+		e.Paragraph2 = generatePlaceholderText(40)
+		e.Paragraph3 = generatePlaceholderText(40)
+		e.Link = fmt.Sprintf("https://%s.com", generatePlaceholderLink(3))
+	}
+	if kind == eximDataInvalidUrl {
+		e.Link = generateInvalidLink()
+	}
+	if kind == eximDataOtherTarget {
+		e.Target = randomOtherEximTarget()
+	}
+	return e
+}
+
+// Creates one exim of every data kind for the test user, reporting which the
+// api server accepted.
+func createEdgeCaseExims() {
+	_, u, ok := loadActiveUser()
+	if !ok {
+		return
+	}
+	if u.Token == "" {
+		logErrorf("test user %s has no token - login first", u.Name)
+		return
+	}
+	for _, kind := range eximDataKinds {
+		logInfof("creating %s exim (seed %d)", kind, dataSeed)
+		eximId := createEximWithFields(u.Token, generateEximFields(kind))
+		if eximId == "" {
+			logInfof("%s exim rejected", kind)
+		} else {
+			logInfof("%s exim accepted", kind)
+		}
+	}
+}
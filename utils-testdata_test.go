@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSeedIsReproducible(t *testing.T) {
+	setDataSeed(42)
+	first := []string{generateRandomEmailAddress(), generatePlaceholderText(10), generateEximFields(eximDataUnicode).Title}
+	setDataSeed(42)
+	second := []string{generateRandomEmailAddress(), generatePlaceholderText(10), generateEximFields(eximDataUnicode).Title}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("value %d differs across runs with the same seed: %q vs %q", i, first[i], second[i])
+		}
+	}
+	if dataSeed != 42 {
+		t.Errorf("dataSeed = %d, want 42", dataSeed)
+	}
+}
+
+func TestGeneratedEmailsAreUnique(t *testing.T) {
+	setDataSeed(7)
+	// Shrink the word list so collisions are certain.
+	oldWords := words
+	words = []string{"a", "b"}
+	t.Cleanup(func() { words = oldWords })
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		email := generateRandomEmailAddress()
+		if seen[email] {
+			t.Fatalf("duplicate email %q", email)
+		}
+		seen[email] = true
+	}
+}
+
+func TestEximFieldLengths(t *testing.T) {
+	at := generateEximFields(eximDataAtLimit)
+	over := generateEximFields(eximDataOverLimit)
+	cases := []struct {
+		name     string
+		at, over string
+		limit    int
+	}{
+		{"title", at.Title, over.Title, maxEximTitleLen},
+		{"summary", at.Summary, over.Summary, maxEximSummaryLen},
+		{"paragraph1", at.Paragraph1, over.Paragraph1, maxEximParagraphLen},
+		{"link", at.Link, over.Link, maxEximLinkLen},
+	}
+	for _, c := range cases {
+		if n := utf8.RuneCountInString(c.at); n != c.limit {
+			t.Errorf("at-limit %s length = %d, want %d", c.name, n, c.limit)
+		}
+		if n := utf8.RuneCountInString(c.over); n != c.limit+1 {
+			t.Errorf("over-limit %s length = %d, want %d", c.name, n, c.limit+1)
+		}
+	}
+}
+
+func TestEximDataKinds(t *testing.T) {
+	targets := make(map[string]bool)
+	for _, target := range eximTargets {
+		targets[target] = true
+	}
+	for _, kind := range eximDataKinds {
+		e := generateEximFields(kind)
+		if !targets[e.Target] {
+			t.Errorf("%s: unexpected target %q", kind, e.Target)
+		}
+		if (kind == eximDataOtherTarget) == (e.Target == "FEDERAL") {
+			t.Errorf("%s: target %q", kind, e.Target)
+		}
+		u, err := url.Parse(e.Link)
+		valid := err == nil && u.Scheme == "https" && u.Host != ""
+		if kind == eximDataInvalidUrl && valid {
+			t.Errorf("%s: link %q parses as valid", kind, e.Link)
+		}
+		if kind != eximDataInvalidUrl && !valid {
+			t.Errorf("%s: link %q is not a valid https url", kind, e.Link)
+		}
+	}
+	if title := generateEximFields(eximDataUnicode).Title; utf8.RuneCountInString(title) == len(title) {
+		t.Errorf("unicode title %q contains only single-byte characters", title)
+	}
+}
+
+func TestCreateEdgeCaseExims(t *testing.T) {
+	f := newFakeApi(t)
+	resetTestUser(t)
+	_, token := loginNewUser(t)
+	saveSessionStore(&sessionStore{Active: "u", Users: []*sessionUser{{Name: "u", Email: "u@email.com", Token: token}}})
+	createEdgeCaseExims()
+	if len(f.exims) != len(eximDataKinds) {
+		t.Errorf("fake stored %d exims, want %d", len(f.exims), len(eximDataKinds))
+	}
+}
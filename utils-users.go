@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// An active login session for a user.
+type userSession struct {
+	IssuedTs  time.Time `json:"issuedTs"`
+	ExpiresTs time.Time `json:"expiresTs"`
+}
+
+// A user's account and auth state as reported to admins.
+type adminUser struct {
+	UserId        string        `json:"userId"`
+	Email         string        `json:"email"`
+	LoginAttempts int           `json:"loginAttempts"`
+	LogoutTs      time.Time     `json:"logoutTs"`
+	IsDisabled    bool          `json:"isDisabled"`
+	Sessions      []userSession `json:"sessions"`
+	EximCount     int           `json:"eximCount"`
+}
+
+// Look up a user by email address or ULID.
+func lookupUser(emailOrUlid string) (adminUser, error) {
+	var resBody userResponse
+	url := fmt.Sprintf("%s/api/admin/user/%s", apiBaseUrl, neturl.PathEscape(emailOrUlid))
+	err := adminGet(url, &resBody, &resBody.Error)
+	return resBody.User, err
+}
+
+// Performs an account action on a user: "reset-login-attempts", "logout",
+// "disable" or "enable".
+func userAction(userId string, action string) error {
+	return adminDo("POST", fmt.Sprintf("%s/api/admin/user/%s/%s", apiBaseUrl, neturl.PathEscape(userId), action))
+}
+
+// Delete a user along with every exim they authored.
+func deleteUser(userId string) error {
+	return adminDo("DELETE", fmt.Sprintf("%s/api/admin/user/%s?exims=true", apiBaseUrl, neturl.PathEscape(userId)))
+}
+
+func printAdminUser(u adminUser) {
+	status := "enabled"
+	if u.IsDisabled {
+		status = "disabled"
+	}
+	logout := "never"
+	if !u.LogoutTs.IsZero() {
+		logout = u.LogoutTs.Format(time.RFC3339)
+	}
+	fmt.Printf("\nuserId: %s\nemail: %s\nstatus: %s\nloginAttempts: %d/%d\nlogoutTs: %s\nexims: %d\nsessions: %d\n",
+		u.UserId, u.Email, status, u.LoginAttempts, maxLoginAttempts, logout, u.EximCount, len(u.Sessions))
+	for _, s := range u.Sessions {
+		fmt.Printf("\tissued %s, expires %s\n", s.IssuedTs.Format(time.RFC3339), s.ExpiresTs.Format(time.RFC3339))
+	}
+}
+
+// Interactive panel to look up a user and manage their account through signed
+// admin endpoints.
+func userAdminPanel() {
+	query := promptLine("User email or ULID (blank to quit): ")
+	for query != "" {
+		user, err := lookupUser(query)
+		if err != nil {
+			query = promptLine("User email or ULID (blank to quit): ")
+			continue
+		}
+		printAdminUser(user)
+
+		input := promptLine("r reset attempts, l force logout, d disable, e enable, x delete, f find another, q quit: ")
+		switch strings.TrimSpace(input) {
+		case "r":
+			if userAction(user.UserId, "reset-login-attempts") == nil {
+				logInfof("reset login attempts for %s", user.Email)
+			}
+		case "l":
+			if userAction(user.UserId, "logout") == nil {
+				logInfof("logged out all sessions for %s", user.Email)
+			}
+		case "d":
+			if userAction(user.UserId, "disable") == nil {
+				logInfof("disabled %s", user.Email)
+			}
+		case "e":
+			if userAction(user.UserId, "enable") == nil {
+				logInfof("enabled %s", user.Email)
+			}
+		case "x":
+			if !confirmDestructive(fmt.Sprintf("delete %s and their %d exims", user.Email, user.EximCount), user.Email) {
+				continue
+			}
+			if deleteUser(user.UserId) == nil {
+				logInfof("deleted %s", user.Email)
+				query = promptLine("User email or ULID (blank to quit): ")
+			}
+		case "f":
+			query = promptLine("User email or ULID (blank to quit): ")
+		case "q":
+			return
+		}
+	}
+}
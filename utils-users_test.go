@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestLookupUser(t *testing.T) {
+	f := newFakeApi(t)
+	userId, token := loginNewUser(t)
+	createExim(token)
+	email := f.users[userId].Email
+
+	for _, query := range []string{userId, email} {
+		u, err := lookupUser(query)
+		if err != nil {
+			t.Fatalf("lookupUser(%s): %v", query, err)
+		}
+		if u.UserId != userId || u.Email != email || len(u.Sessions) != 1 || u.EximCount != 1 {
+			t.Errorf("lookupUser(%s) = %+v", query, u)
+		}
+	}
+	if _, err := lookupUser("nobody@email.com"); err == nil {
+		t.Error("expected error looking up unknown user")
+	}
+}
+
+func TestUserActions(t *testing.T) {
+	f := newFakeApi(t)
+	userId, _ := loginNewUser(t)
+	u := f.users[userId]
+	u.LoginAttempts = 3
+
+	if err := userAction(userId, "reset-login-attempts"); err != nil || u.LoginAttempts != 0 {
+		t.Errorf("reset-login-attempts: err %v, attempts %d", err, u.LoginAttempts)
+	}
+	if err := userAction(userId, "logout"); err != nil || len(f.tokens) != 0 {
+		t.Errorf("logout: err %v, %d live tokens", err, len(f.tokens))
+	}
+	if err := userAction(userId, "disable"); err != nil || !u.IsDisabled {
+		t.Errorf("disable: err %v, disabled %v", err, u.IsDisabled)
+	}
+	if _, err := login(u.Email); err == nil {
+		t.Error("disabled user was able to log in")
+	}
+	if err := userAction(userId, "enable"); err != nil || u.IsDisabled {
+		t.Errorf("enable: err %v, disabled %v", err, u.IsDisabled)
+	}
+	if err := userAction(userId, "explode"); err == nil {
+		t.Error("expected error for unknown action")
+	}
+}
+
+func TestUserAdminPanelDelete(t *testing.T) {
+	f := newFakeApi(t)
+	userId, token := loginNewUser(t)
+	createExim(token)
+	_, otherToken := loginNewUser(t)
+	otherExim := createExim(otherToken)
+	email := f.users[userId].Email
+
+	// Mistyped confirmation cancels, then the correct email deletes.
+	withInput(t, "nobody@email.com", email, "x", "wrong", "x", email, "")
+	userAdminPanel()
+
+	if _, ok := f.users[userId]; ok {
+		t.Error("user was not deleted")
+	}
+	if len(f.exims) != 1 || f.exims[otherExim] == nil {
+		t.Errorf("remaining exims = %d, want only the other user's", len(f.exims))
+	}
+}
+
+func TestUserAdminPanelActions(t *testing.T) {
+	f := newFakeApi(t)
+	userId, _ := loginNewUser(t)
+	f.users[userId].LoginAttempts = 2
+
+	withInput(t, userId, "r", "l", "d", "e", "d", "q")
+	userAdminPanel()
+
+	u := f.users[userId]
+	if u.LoginAttempts != 0 || len(f.tokens) != 0 || !u.IsDisabled {
+		t.Errorf("user after panel = %+v, live tokens %d", u, len(f.tokens))
+	}
+}